@@ -1,11 +1,18 @@
 package main
 
 import (
+	"os"
+
 	"fyne.io/fyne/v2/app"
+	"github.com/coolapso/picsort/internal/cli"
 	"github.com/coolapso/picsort/internal/ui"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
 	a := app.NewWithID("picsort")
 	w := a.NewWindow("PicSort")
 
@@ -0,0 +1,657 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/coolapso/picsort/internal/controller"
+	"github.com/coolapso/picsort/internal/data"
+)
+
+const usage = `Usage: picsort [command] [arguments]
+
+Running picsort without a command starts the graphical interface.
+
+Commands:
+  cache [options] <dataset>            generate the thumbnail and preview cache
+    --external                         create the database in the cache directory instead of the dataset
+    --regenerate                       generate the cache of every image again, keeping their bins
+    --thumbnail-size <pixels>          size thumbnails are scaled down to fit in, 200 by default
+    --preview-size <width>x<height>    size previews are scaled down to fit in, 800x600 by default
+    --filter <filter>                  nearest, bilinear, bicubic, mitchell, lanczos2 or lanczos3
+    --quality <1-100>                  JPEG quality of thumbnails and previews, 75 by default
+                                       cache settings are stored in the dataset, changing them
+                                       regenerates the cache
+  cache-info <dataset>                 show where the cache is, how many images it holds and its size
+  cache-clean [--force] <dataset>      remove images that no longer exist from the cache and compact it
+    --force                            remove them even when most of the dataset is missing
+  cache-location <dataset> [dataset|cache]
+                                       show where the database of the dataset is, or move it
+                                       into the dataset folder or the cache directory
+  export [options] <dataset> <dest>    export the sorted images to dest
+    --balanced                         downsample every bin to the smallest one and split them
+    --stratified                       split every bin without discarding images
+    --oversample                       duplicate training images of the smaller bins, stratified
+                                       only, folds are never oversampled
+    --class-weights                    write class_weights.json, stratified only
+    --split <ratios>                   training, validation and optional test ratios, e.g. 0.7,0.15,0.15
+    --folds <k>                        split into k folds plus the test ratio, 0 to disable
+    --remainder <distribute|train>     where images left over by rounding the ratios go
+    --seed <n>                         seed used to shuffle the images before splitting
+    --pin                              pin exported images to their split for later exports
+    --unpin                            clear pinned split assignments before exporting
+    --keep-clusters                    keep every cluster of near-duplicates in a single split
+    --cluster-hash <algorithm>         average, difference or perceptual hash for near-duplicates
+    --cluster-threshold <bits>         how many bits the hashes of near-duplicates can differ in
+                                       split options and seed are stored in the dataset and reused
+  stats <dataset>                      show how many images are in each bin
+  name <dataset> <bin> [name]          name a bin, used as its folder name on exports
+  relink <dataset> [old-path]          repair the database of a dataset moved from old-path,
+                                       which is guessed from the images when not given
+  duplicates [--exclude] <dataset>     list groups of byte-identical images
+    --exclude                          keep one image of each group and exclude the others
+  help                                 show this message
+`
+
+var (
+	errUsage       = errors.New("invalid arguments")
+	errInterrupted = errors.New("interrupted, the work done until then was kept")
+)
+
+type command struct {
+	// ctx is cancelled when the command is interrupted
+	ctx        context.Context
+	ui         *TerminalUI
+	controller *controller.Controller
+	out        io.Writer
+}
+
+// Run executes the headless command in args and returns the process exit code.
+func Run(args []string) int {
+	return run(args, os.Stdout, os.Stderr)
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := newCommand(ctx, stdout, stderr)
+	defer c.controller.Close()
+
+	var err error
+	switch args[0] {
+	case "cache":
+		err = c.cache(args[1:])
+	case "cache-info":
+		err = c.cacheInfo(args[1:])
+	case "cache-clean":
+		err = c.cacheClean(args[1:])
+	case "cache-location":
+		err = c.cacheLocation(args[1:])
+	case "export":
+		err = c.export(args[1:])
+	case "stats":
+		err = c.stats(args[1:])
+	case "name":
+		err = c.name(args[1:])
+	case "relink":
+		err = c.relink(args[1:])
+	case "duplicates":
+		err = c.duplicates(args[1:])
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		err = fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+	}
+
+	if err != nil {
+		// errors reported by the controller were already printed
+		if !errors.Is(err, c.ui.Err()) {
+			fmt.Fprintln(stderr, "error:", err)
+		}
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(stderr, usage)
+			return 2
+		}
+		return 1
+	}
+
+	return 0
+}
+
+func (c *command) cache(args []string) error {
+	fs := flag.NewFlagSet("cache", flag.ContinueOnError)
+	external := fs.Bool("external", false, "create the database in the cache directory instead of the dataset")
+	regenerate := fs.Bool("regenerate", false, "generate the cache of every image again, keeping their bins")
+	thumbnailSize := fs.Int("thumbnail-size", 0, "size in pixels thumbnails are scaled down to fit in")
+	previewSize := fs.String("preview-size", "", "size previews are scaled down to fit in, e.g. 1920x1080")
+	filter := fs.String("filter", "", "resampling filter, nearest, bilinear, bicubic, mitchell, lanczos2 or lanczos3")
+	quality := fs.Int("quality", 0, "JPEG quality of thumbnails and previews, 1 to 100")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: cache expects a dataset directory", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	c.controller.SetExternalCache(*external)
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	if *thumbnailSize > 0 || *previewSize != "" || *filter != "" || *quality > 0 {
+		config, err := c.controller.GetCacheConfig()
+		if err != nil {
+			return err
+		}
+		if *thumbnailSize > 0 {
+			config.ThumbnailSize = uint(*thumbnailSize)
+		}
+		if *previewSize != "" {
+			if config.PreviewWidth, config.PreviewHeight, err = data.ParseSize(*previewSize); err != nil {
+				return fmt.Errorf("%w: %v", errUsage, err)
+			}
+		}
+		if *filter != "" {
+			config.Filter = data.ResizeFilter(*filter)
+		}
+		if *quality > 0 {
+			config.Quality = *quality
+		}
+		if err := c.controller.SetCacheConfig(config); err != nil {
+			return fmt.Errorf("%w: %v", errUsage, err)
+		}
+		fmt.Fprintf(c.out, "cache: %s\n", config)
+	}
+
+	if *regenerate {
+		c.controller.RegenerateCache(c.ctx)
+	} else {
+		c.controller.LoadDataset(c.ctx, path)
+	}
+	return c.err()
+}
+
+func (c *command) cacheInfo(args []string) error {
+	fs := flag.NewFlagSet("cache-info", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: cache-info expects a dataset directory", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	dbPath, _, err := c.controller.CachePath()
+	if err != nil {
+		return err
+	}
+
+	stats, err := c.controller.GetCacheStats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%-20s %s\n", "location", dbPath)
+	fmt.Fprintf(c.out, "%-20s %d\n", "images", stats.Images)
+	if stats.Pending > 0 {
+		fmt.Fprintf(c.out, "%-20s %d\n", "pending", stats.Pending)
+	}
+	fmt.Fprintf(c.out, "%-20s %s\n", "thumbnails", data.FormatSize(stats.Thumbnails))
+	fmt.Fprintf(c.out, "%-20s %s\n", "previews", data.FormatSize(stats.Previews))
+	fmt.Fprintf(c.out, "%-20s %s\n", "database", data.FormatSize(stats.File))
+
+	return nil
+}
+
+func (c *command) cacheClean(args []string) error {
+	fs := flag.NewFlagSet("cache-clean", flag.ContinueOnError)
+	force := fs.Bool("force", false, "remove missing images even when most of the dataset is missing")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: cache-clean expects a dataset directory", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	before, err := c.controller.GetCacheStats()
+	if err != nil {
+		return err
+	}
+
+	removed, err := c.controller.CleanCache(*force)
+	if err != nil {
+		return err
+	}
+
+	after, err := c.controller.GetCacheStats()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "removed %d missing images, database %s -> %s\n", removed, data.FormatSize(before.File), data.FormatSize(after.File))
+
+	return nil
+}
+
+func (c *command) cacheLocation(args []string) error {
+	fs := flag.NewFlagSet("cache-location", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("%w: cache-location expects a dataset directory and optionally dataset or cache", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	if len(positional) == 2 {
+		var external bool
+		switch positional[1] {
+		case "dataset":
+		case "cache":
+			external = true
+		default:
+			return fmt.Errorf("%w: unknown cache location %q, expected dataset or cache", errUsage, positional[1])
+		}
+		if _, err := c.controller.MoveCache(external); err != nil {
+			return err
+		}
+	}
+
+	dbPath, _, err := c.controller.CachePath()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, dbPath)
+
+	return nil
+}
+
+func (c *command) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	balanced := fs.Bool("balanced", false, "balance the bins and split them into training, validation and test sets")
+	stratified := fs.Bool("stratified", false, "split every bin into training, validation and test sets without discarding images")
+	oversample := fs.Bool("oversample", false, "duplicate training images of the smaller bins, stratified only")
+	classWeights := fs.Bool("class-weights", false, "write class_weights.json computed from the training images, stratified only")
+	ratios := fs.String("split", "", "comma separated training, validation and optional test ratios, e.g. 0.7,0.15,0.15")
+	folds := fs.Int("folds", -1, "split into k folds plus the test ratio instead of training and validation sets, 0 to disable")
+	remainder := fs.String("remainder", "", "where images left over by rounding go, distribute or train")
+	seed := fs.String("seed", "", "seed used to shuffle images before splitting them")
+	pin := fs.Bool("pin", false, "pin every exported image to its split so it never moves on later exports")
+	unpin := fs.Bool("unpin", false, "clear all pinned split assignments before exporting")
+	keepClusters := fs.Bool("keep-clusters", false, "keep every cluster of near-duplicate images in a single split")
+	clusterHash := fs.String("cluster-hash", "", "hash used to find near-duplicates, average, difference or perceptual")
+	clusterThreshold := fs.Int("cluster-threshold", -1, "number of bits the hashes of near-duplicates can differ in")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("%w: export expects a dataset directory and a destination", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	dest, err := filepath.Abs(positional[1])
+	if err != nil {
+		return err
+	}
+
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	if *balanced && *stratified {
+		return fmt.Errorf("%w: --balanced and --stratified cannot be used together", errUsage)
+	}
+
+	opts := controller.ExportOptions{
+		PinSplits:    *pin,
+		Oversample:   *oversample,
+		ClassWeights: *classWeights,
+		KeepClusters: *keepClusters,
+	}
+	switch {
+	case *balanced:
+		opts.Mode = controller.ExportBalanced
+	case *stratified:
+		opts.Mode = controller.ExportStratified
+	}
+
+	if opts.Mode != controller.ExportFolders {
+		split, err := c.controller.GetSplitConfig()
+		if err != nil {
+			return err
+		}
+
+		if *ratios != "" {
+			if split.Train, split.Validation, split.Test, err = data.ParseRatios(*ratios); err != nil {
+				return fmt.Errorf("%w: %v", errUsage, err)
+			}
+		}
+		if *folds >= 0 {
+			split.Folds = *folds
+		}
+		if *remainder != "" {
+			split.Remainder = data.RemainderPolicy(*remainder)
+		}
+
+		if err := c.controller.SetSplitConfig(split); err != nil {
+			return fmt.Errorf("%w: %v", errUsage, err)
+		}
+		fmt.Fprintln(c.out, "split:", split)
+
+		if *seed != "" {
+			s, err := strconv.ParseUint(*seed, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%w: invalid seed: %v", errUsage, err)
+			}
+			if err := c.controller.SetSplitSeed(s); err != nil {
+				return err
+			}
+		}
+
+		s, err := c.controller.GetSplitSeed()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "seed:", s)
+
+		if *unpin {
+			if err := c.controller.ClearSplitPins(); err != nil {
+				return err
+			}
+		}
+
+		if *keepClusters {
+			config, err := c.controller.GetClusterConfig()
+			if err != nil {
+				return err
+			}
+			if *clusterHash != "" {
+				config.Algorithm = data.HashAlgorithm(*clusterHash)
+			}
+			if *clusterThreshold >= 0 {
+				config.Threshold = *clusterThreshold
+			}
+			if err := c.controller.SetClusterConfig(config); err != nil {
+				return fmt.Errorf("%w: %v", errUsage, err)
+			}
+			fmt.Fprintf(c.out, "near-duplicates: %s hash, %d bits\n", config.Algorithm, config.Threshold)
+		}
+	}
+
+	c.controller.ExportDataset(c.ctx, dest, opts)
+	return c.err()
+}
+
+func (c *command) stats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: stats expects a dataset directory", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	counts, err := c.controller.GetBinCounts()
+	if err != nil {
+		return err
+	}
+
+	names, err := c.controller.GetBinNames()
+	if err != nil {
+		return err
+	}
+
+	ids := make([]int, 0, len(counts))
+	total := 0
+	for id, count := range counts {
+		ids = append(ids, id)
+		total += count
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		fmt.Fprintf(c.out, "%-20s %d\n", binName(id, names[id]), counts[id])
+	}
+	fmt.Fprintf(c.out, "%-20s %d\n", "total", total)
+
+	return nil
+}
+
+func (c *command) name(args []string) error {
+	fs := flag.NewFlagSet("name", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 2 || len(positional) > 3 {
+		return fmt.Errorf("%w: name expects a dataset directory, a bin number and an optional name", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(positional[1])
+	if err != nil {
+		return fmt.Errorf("%w: invalid bin number %q", errUsage, positional[1])
+	}
+
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	var name string
+	if len(positional) == 3 {
+		name = positional[2]
+	}
+
+	return c.controller.SetBinName(id, name)
+}
+
+func (c *command) relink(args []string) error {
+	fs := flag.NewFlagSet("relink", flag.ContinueOnError)
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("%w: relink expects a dataset directory and optionally its old path", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	var oldRoot string
+	if len(positional) == 2 {
+		if oldRoot, err = filepath.Abs(positional[1]); err != nil {
+			return err
+		}
+	}
+
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	n, err := c.controller.Relink(oldRoot)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "relinked %d images\n", n)
+
+	return nil
+}
+
+func (c *command) duplicates(args []string) error {
+	fs := flag.NewFlagSet("duplicates", flag.ContinueOnError)
+	exclude := fs.Bool("exclude", false, "")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: duplicates expects a dataset directory", errUsage)
+	}
+
+	path, err := datasetPath(positional[0])
+	if err != nil {
+		return err
+	}
+
+	if err := c.controller.OpenDataset(path); err != nil {
+		return err
+	}
+
+	groups, err := c.controller.GetDuplicates()
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		for _, imgPath := range group {
+			fmt.Fprintln(c.out, imgPath)
+		}
+		fmt.Fprintln(c.out)
+	}
+	fmt.Fprintf(c.out, "%d groups of duplicates\n", len(groups))
+
+	if *exclude && len(groups) > 0 {
+		if err := c.controller.ExcludeDuplicates(groups); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.out, "excluded the copies")
+	}
+
+	return nil
+}
+
+func binName(id int, name string) string {
+	switch {
+	case id == -1:
+		return "excluded"
+	case id == 0:
+		return "to sort"
+	case name != "":
+		return fmt.Sprintf("bin %d (%s)", id, name)
+	default:
+		return fmt.Sprintf("bin %d", id)
+	}
+}
+
+// parseArgs parses flags placed anywhere between the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, fmt.Errorf("%w: %v", errUsage, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func datasetPath(arg string) (string, error) {
+	path, err := filepath.Abs(arg)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", path)
+	}
+
+	return path, nil
+}
+
+// err returns why a long running command did not complete, if it didn't.
+func (c *command) err() error {
+	if c.ctx.Err() != nil {
+		return errInterrupted
+	}
+
+	return c.ui.Err()
+}
+
+func newCommand(ctx context.Context, out, errOut io.Writer) *command {
+	ui := NewTerminalUI(out, errOut)
+	return &command{
+		ctx:        ctx,
+		ui:         ui,
+		controller: controller.New(ui),
+		out:        out,
+	}
+}
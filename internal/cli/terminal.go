@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// TerminalUI is a non graphical implementation of controller.CoreUI that reports
+// progress to out and errors to errOut.
+type TerminalUI struct {
+	out     io.Writer
+	errOut  io.Writer
+	mut     *sync.Mutex
+	percent int
+	err     error
+}
+
+func (t *TerminalUI) ShowProgressDialog(msg string) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.percent = -1
+	fmt.Fprintln(t.out, msg)
+}
+
+// SetProgress only prints when the integer percentage changes, so logs stay readable
+// when thousands of images are processed.
+func (t *TerminalUI) SetProgress(progress float64, f string) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	percent := int(progress * 100)
+	if percent == t.percent {
+		return
+	}
+	t.percent = percent
+	fmt.Fprintf(t.out, "[%3d%%] %s\n", percent, f)
+}
+
+// SetCacheProgress reports the background caching like any other progress, commands wait for
+// it to finish. The end of caching is not printed, it would read as complete when interrupted.
+func (t *TerminalUI) SetCacheProgress(progress float64, f string) {
+	if f == "" {
+		return
+	}
+	t.SetProgress(progress, f)
+}
+
+func (t *TerminalUI) ShowErrorDialog(err error) {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	t.err = err
+	fmt.Fprintln(t.errOut, "error:", err)
+}
+
+func (t *TerminalUI) HideProgressDialog() {}
+
+func (t *TerminalUI) LoadContent() {}
+
+func (t *TerminalUI) ReloadBin(id int) {}
+
+// Err returns the last error reported by the controller.
+func (t *TerminalUI) Err() error {
+	t.mut.Lock()
+	defer t.mut.Unlock()
+	return t.err
+}
+
+func NewTerminalUI(out, errOut io.Writer) *TerminalUI {
+	return &TerminalUI{
+		out:     out,
+		errOut:  errOut,
+		mut:     &sync.Mutex{},
+		percent: -1,
+	}
+}
@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	binLayoutKey = "bin_layout"
+	// lastBinIDKey is the id of the last bin created, ids are never given to a new bin twice.
+	lastBinIDKey    = "last_bin_id"
+	defaultBinCount = 6
+)
+
+var (
+	errReservedBin           = errors.New("the To Sort and excluded bins cannot be renamed or removed")
+	errInvalidBinName        = errors.New("bin names cannot be numbers or contain path separators")
+	errDuplicateBinName      = errors.New("another bin already has this name")
+	errInvalidDestinationBin = errors.New("images cannot be moved into the bin being removed")
+)
+
+// GetBinNames returns the name given to each bin, unnamed bins are not included.
+func (c *Controller) GetBinNames() (map[int]string, error) {
+	if c.db == nil {
+		return nil, errNoDataset
+	}
+
+	return c.db.GetBinNames()
+}
+
+// GetBinName returns the name given to a bin, or an empty string if it has none.
+func (c *Controller) GetBinName(id int) string {
+	if c.db == nil {
+		return ""
+	}
+
+	names, err := c.db.GetBinNames()
+	if err != nil {
+		log.Printf("failed to get name of bin %d: %v", id, err)
+		return ""
+	}
+
+	return names[id]
+}
+
+// SetBinName names a bin, the name is used on the bin tab and as the folder name on
+// exports, an empty name resets it back to the bin number.
+func (c *Controller) SetBinName(id int, name string) error {
+	if c.db == nil {
+		return errNoDataset
+	}
+	if id <= 0 {
+		return errReservedBin
+	}
+
+	name = strings.TrimSpace(name)
+	if _, err := strconv.Atoi(name); err == nil || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return errInvalidBinName
+	}
+
+	names, err := c.db.GetBinNames()
+	if err != nil {
+		return err
+	}
+	for binID, binName := range names {
+		if binID != id && name != "" && strings.EqualFold(binName, name) {
+			return errDuplicateBinName
+		}
+	}
+
+	return c.db.SetBinName(id, name)
+}
+
+// binFolderName returns the folder a bin is exported to, its name in names if it has one
+// or its number otherwise.
+func binFolderName(names map[int]string, id int) string {
+	if name := names[id]; name != "" {
+		return name
+	}
+
+	return fmt.Sprint(id)
+}
+
+// GetBinLayout returns the ids of the bins in the order their tabs are shown, the
+// To Sort bin always comes first. Bins holding images that are missing from the stored
+// layout are appended to it, so their images are never hidden.
+func (c *Controller) GetBinLayout() ([]int, error) {
+	layout := make([]int, defaultBinCount)
+	for i := range layout {
+		layout[i] = i
+	}
+	if c.db == nil {
+		return layout, nil
+	}
+
+	value, err := c.db.GetMetadata(binLayoutKey)
+	if err != nil {
+		return layout, err
+	}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &layout); err != nil {
+			return layout, fmt.Errorf("invalid bin layout stored in dataset: %v", err)
+		}
+	}
+
+	if !slices.Contains(layout, 0) {
+		layout = append([]int{0}, layout...)
+	}
+
+	counts, err := c.db.GetBinCounts()
+	if err != nil {
+		return layout, err
+	}
+
+	var missing []int
+	for id := range counts {
+		if id > 0 && !slices.Contains(layout, id) {
+			missing = append(missing, id)
+		}
+	}
+	slices.Sort(missing)
+
+	return append(layout, missing...), nil
+}
+
+// SetBinLayout stores the ids of the bins in the order their tabs are shown. Nothing
+// is stored until a dataset is loaded.
+func (c *Controller) SetBinLayout(layout []int) error {
+	if c.db == nil {
+		return nil
+	}
+
+	value, err := json.Marshal(layout)
+	if err != nil {
+		return err
+	}
+
+	return c.db.SetMetadata(binLayoutKey, string(value))
+}
+
+// NewBinID returns the id of a new bin, added to the bins of layout. Ids are never reused, so
+// undoing the removal of a bin restores it as it was instead of into a newer bin with its id.
+func (c *Controller) NewBinID(layout []int) (int, error) {
+	last := slices.Max(layout)
+	if c.db == nil {
+		return last + 1, nil
+	}
+
+	value, err := c.db.GetMetadata(lastBinIDKey)
+	if err != nil {
+		return 0, err
+	}
+	if value != "" {
+		stored, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid last bin id stored in dataset: %v", err)
+		}
+		last = max(last, stored)
+	}
+
+	// datasets sorted before ids were recorded may have used higher ids since removed
+	highest, err := c.db.GetHighestBinID()
+	if err != nil {
+		return 0, err
+	}
+
+	id := max(last, highest) + 1
+	return id, c.db.SetMetadata(lastBinIDKey, strconv.Itoa(id))
+}
+
+// RemoveBin empties a bin by moving its images to destID, which can be the To Sort
+// bin, another bin or the excluded bin (-1). The bin layout is left to the caller.
+func (c *Controller) RemoveBin(id, destID int) error {
+	if c.db == nil {
+		// without a dataset there are no images to move
+		return nil
+	}
+	if id <= 0 {
+		return errReservedBin
+	}
+	if id == destID {
+		return errInvalidDestinationBin
+	}
+
+	return c.db.RemoveBin(id, destID)
+}
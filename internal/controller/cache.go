@@ -0,0 +1,176 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/coolapso/picsort/internal/data"
+	"github.com/coolapso/picsort/internal/database"
+)
+
+const (
+	cacheConfigKey = "cache_config"
+	// builtCacheConfigKey is the config the cached thumbnails and previews were generated with.
+	builtCacheConfigKey = "cache_built_config"
+)
+
+// SetExternalCache sets whether the databases of datasets opened from now on are created in the
+// cache directory instead of the dataset folder. Existing databases are used wherever they are.
+func (c *Controller) SetExternalCache(external bool) {
+	c.externalCache = external
+}
+
+// CachePath returns the path of the database of the open dataset and whether it is kept in the
+// cache directory rather than in the dataset.
+func (c *Controller) CachePath() (string, bool, error) {
+	if c.db == nil {
+		return "", false, errNoDataset
+	}
+
+	return c.db.Path(), database.IsExternal(c.db.Path()), nil
+}
+
+// MoveCache moves the database of the open dataset into the cache directory when external is set,
+// or back into the dataset folder otherwise, and returns its new path.
+func (c *Controller) MoveCache(external bool) (string, error) {
+	if c.db == nil {
+		return "", errNoDataset
+	}
+
+	// images must not be cached nor synced while the database is closed
+	c.mut.Lock()
+	watching := c.watcher != nil
+	c.mut.Unlock()
+	c.stopCaching()
+	c.StopWatching()
+	c.setDB(nil)
+
+	path, err := database.Move(c.datasetRoot, external)
+	// the database is reopened wherever it ended up so the dataset stays usable
+	if dbErr := c.dbinit(c.datasetRoot); dbErr != nil {
+		return path, dbErr
+	}
+
+	if watching {
+		if watchErr := c.WatchDataset(); watchErr != nil && err == nil {
+			err = watchErr
+		}
+	}
+
+	return path, err
+}
+
+// GetCacheStats returns how many images are cached for the open dataset and how much space they take.
+func (c *Controller) GetCacheStats() (data.CacheStats, error) {
+	if c.db == nil {
+		return data.CacheStats{}, errNoDataset
+	}
+
+	return c.db.GetCacheStats()
+}
+
+// CleanCache removes the images that no longer exist in the dataset from the cache, relinking
+// the ones that were renamed or moved first, and compacts the database. It returns the number
+// of removed images. Unless force is set, it returns ErrMostImagesMissing instead of removing
+// most images of the dataset.
+func (c *Controller) CleanCache(force bool) (int, error) {
+	if c.db == nil {
+		return 0, errNoDataset
+	}
+
+	d, err := data.NewDataset(c.datasetRoot)
+	if err != nil {
+		return 0, err
+	}
+
+	cached, err := c.db.GetImageStats()
+	if err != nil {
+		return 0, err
+	}
+
+	removed, err := c.pruneImages(d, cached, force)
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, c.db.Vacuum()
+}
+
+// RegenerateCache generates the thumbnails and previews of every image of the open dataset again,
+// e.g. after the thumbnail sizes changed, keeping the images in their bins. Cancelling ctx stops
+// it, leaving the images not regenerated yet as they were.
+func (c *Controller) RegenerateCache(ctx context.Context) {
+	if c.db == nil {
+		c.ui.ShowErrorDialog(errNoDataset)
+		return
+	}
+
+	c.loadDataset(ctx, c.datasetRoot, true)
+}
+
+// GetCacheConfig returns how thumbnails and previews of the dataset are generated, or the
+// default 200 pixel thumbnails and 800x600 previews if it was never changed.
+func (c *Controller) GetCacheConfig() (data.CacheConfig, error) {
+	return c.getCacheConfig(cacheConfigKey)
+}
+
+// SetCacheConfig validates and stores how thumbnails and previews of the dataset are generated.
+// The cache is regenerated the next time the dataset is loaded if the config changed.
+func (c *Controller) SetCacheConfig(config data.CacheConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if err := c.setCacheConfig(cacheConfigKey, config); err != nil {
+		return err
+	}
+
+	c.mut.Lock()
+	c.cacheConfig = config
+	c.mut.Unlock()
+	return nil
+}
+
+// cacheStale reports whether the cached images were generated with a different config than the
+// current one. Caches generated before the config was recorded used the default config.
+func (c *Controller) cacheStale() (bool, error) {
+	built, err := c.getCacheConfig(builtCacheConfigKey)
+	if err != nil {
+		return false, err
+	}
+
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	return built != c.cacheConfig, nil
+}
+
+func (c *Controller) getCacheConfig(key string) (data.CacheConfig, error) {
+	config := data.DefaultCacheConfig()
+	if c.db == nil {
+		return config, nil
+	}
+
+	value, err := c.db.GetMetadata(key)
+	if err != nil || value == "" {
+		return config, err
+	}
+
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return config, fmt.Errorf("invalid cache configuration stored in dataset: %v", err)
+	}
+
+	return config, nil
+}
+
+func (c *Controller) setCacheConfig(key string, config data.CacheConfig) error {
+	if c.db == nil {
+		return errNoDataset
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return c.db.SetMetadata(key, string(value))
+}
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+const clusterConfigKey = "cluster_config"
+
+// hashCachedImages computes the perceptual hashes of the images cached before they were
+// introduced, from their thumbnails so the images don't need to be decoded again. The hashes
+// computed before ctx is cancelled are kept.
+func (c *Controller) hashCachedImages(ctx context.Context) error {
+	paths, err := c.db.GetUnhashedImages()
+	if err != nil || len(paths) == 0 {
+		return err
+	}
+
+	c.ui.ShowProgressDialog("computing perceptual hashes...")
+	jobs := make(chan string, len(paths))
+	for _, path := range paths {
+		jobs <- path
+	}
+	close(jobs)
+
+	var processedCount int64
+	wg := &sync.WaitGroup{}
+	for range runtime.NumCPU() {
+		wg.Go(func() {
+			for path := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				thumb := c.GetThumbnail(path)
+				if thumb == nil {
+					continue
+				}
+				if err := c.db.SetPerceptualHashes(path, data.NewPerceptualHashes(thumb)); err != nil {
+					log.Printf("could not store perceptual hashes of %s: %v", path, err)
+					continue
+				}
+				progress := float64(atomic.AddInt64(&processedCount, 1)) / float64(len(paths))
+				c.ui.SetProgress(progress, filepath.Base(path))
+			}
+		})
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// GetClusterConfig returns how near-duplicates are grouped in the dataset, or the default
+// perceptual hash with an 8 bit threshold if it was never changed.
+func (c *Controller) GetClusterConfig() (data.ClusterConfig, error) {
+	config := data.DefaultClusterConfig()
+	if c.db == nil {
+		return config, nil
+	}
+
+	value, err := c.db.GetMetadata(clusterConfigKey)
+	if err != nil || value == "" {
+		return config, err
+	}
+
+	if err := json.Unmarshal([]byte(value), &config); err != nil {
+		return config, fmt.Errorf("invalid near-duplicate configuration stored in dataset: %v", err)
+	}
+
+	return config, nil
+}
+
+// SetClusterConfig validates and stores how near-duplicates are grouped in the dataset, so
+// exports keep the same clusters together.
+func (c *Controller) SetClusterConfig(config data.ClusterConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if c.db == nil {
+		return errNoDataset
+	}
+
+	value, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	return c.db.SetMetadata(clusterConfigKey, string(value))
+}
+
+// GetNearDuplicates returns the clusters of near-duplicate images in the dataset.
+func (c *Controller) GetNearDuplicates(config data.ClusterConfig) ([][]string, error) {
+	if c.db == nil {
+		return nil, errNoDataset
+	}
+
+	hashes, err := c.db.GetPerceptualHashes()
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Cluster(hashes), nil
+}
@@ -1,16 +1,18 @@
 package controller
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
+	_ "image/jpeg"
+	_ "image/png"
 	"log"
-	"math/rand/v2"
 	"os"
-	"path/filepath"
 	"runtime"
+	"slices"
 	"sync"
-	"sync/atomic"
 
 	"github.com/coolapso/picsort/internal/data"
 	"github.com/coolapso/picsort/internal/database"
@@ -18,122 +20,215 @@ import (
 )
 
 var (
-	errInvalidDestination = errors.New("cannot export dataset to the same location, please choose a different destination")
+	errNoDataset = errors.New("no dataset loaded")
 )
 
 type CoreUI interface {
 	ShowProgressDialog(msg string)
 	SetProgress(progress float64, f string)
+	// SetCacheProgress reports the progress of the background caching, without blocking the
+	// interface. Once caching ends, complete or not, it is called with 1 and no file name.
+	SetCacheProgress(progress float64, f string)
 	ShowErrorDialog(err error)
 	HideProgressDialog()
-	GetBinCount() int
 	LoadContent()
+	ReloadBin(id int)
 }
 
 type Controller struct {
-	ui          CoreUI
-	db          *database.DB
+	ui CoreUI
+	db *database.DB
+	// dbMut guards swapping db against the thumbnails and previews read from it off the
+	// controller, by the interface and the prefetcher, and the changes synced by the watcher.
+	dbMut       sync.RWMutex
 	datasetRoot string
-	newCached   bool
 	mut         *sync.Mutex
+	watcher     *datasetWatcher
+	// externalCache stores new dataset databases in the cache directory instead of the dataset.
+	externalCache bool
+	// cacheConfig is how thumbnails and previews of the open dataset are generated.
+	cacheConfig data.CacheConfig
+	// queue holds the images being cached in the background, nil when idle.
+	queue *cacheQueue
+	// thumbnails and previews hold the recently shown images decoded, prefetch the images
+	// to decode ahead of being shown.
+	thumbnails *imageCache
+	previews   *imageCache
+	prefetch   chan []string
+}
+
+func (c *Controller) dbinit(path string) error {
+	c.setDB(nil)
+	c.forgetAllImages()
 
-	wg   *sync.WaitGroup
-	jobs chan string
+	db, err := database.New(path, c.externalCache)
+	if err != nil {
+		log.Println("error opening database:", err)
+		return err
+	}
+
+	c.setDB(db)
+	return nil
 }
 
-func (c *Controller) copyImages(imgPaths []string, datasetRoot string, binID int) error {
-	total := float64(len(imgPaths))
-	var copiedCount int64
-	var failedCopy []string
+// setDB replaces the dataset database with db, closing the previous one once no image is being
+// read from it anymore.
+func (c *Controller) setDB(db *database.DB) {
+	c.dbMut.Lock()
+	old := c.db
+	c.db = db
+	c.dbMut.Unlock()
 
-	destinationDir := filepath.Join(datasetRoot, fmt.Sprint(binID))
-	err := os.Mkdir(destinationDir, 0755)
-	if err != nil && !os.IsExist(err) {
-		return fmt.Errorf("failed to create destination directory: %v", err)
+	if old != nil {
+		old.Close()
 	}
+}
 
-	for _, imgPath := range imgPaths {
-		var img []byte
-		fileName := filepath.Base(imgPath)
-		img, err := os.ReadFile(imgPath)
-		if err != nil {
-			log.Println("Failed to read file:", err)
-			failedCopy = append(failedCopy, fileName)
-			continue
-		}
-		destinationPath := filepath.Join(destinationDir, fileName)
-		err = os.WriteFile(destinationPath, img, 0644)
-		if err != nil {
-			log.Println("Failed to write file to destination:", err)
-			failedCopy = append(failedCopy, fileName)
-			continue
+// cacheImages generates the thumbnail and preview of the images handed out by the queue and hands
+// them to the writer, waiting for it when it falls behind.
+func (c *Controller) cacheImages(q *cacheQueue, results chan<- cacheResult, stats, cached map[string]data.FileStat) {
+	for {
+		imgPath, ok := q.pop()
+		if !ok {
+			return
 		}
-		atomic.AddInt64(&copiedCount, 1)
-		progress := float64(atomic.LoadInt64(&copiedCount)) / total
-		c.ui.SetProgress(progress, fmt.Sprintf("bin %d/%s", binID, fileName))
+
+		old, found := cached[imgPath]
+		img, stat, err := c.generateImage(imgPath, stats[imgPath], old, found)
+		results <- cacheResult{path: imgPath, image: img, stat: stat, err: err}
 	}
+}
 
-	if len(failedCopy) > 0 {
-		return fmt.Errorf("failed to copy %d files, check logfile for more details", len(failedCopy))
+// cacheInBackground caches paths with a worker per CPU, the images shown in the grid first, and
+// returns once they are all cached. The workers only read and scale down images, a single writer
+// stores them in batches. It returns false if caching was stopped or ctx cancelled before, or the
+// database could not be written, the images stored until then stay cached.
+func (c *Controller) cacheInBackground(ctx context.Context, paths []string, stats, cached map[string]data.FileStat) bool {
+	q := newCacheQueue(paths)
+	c.mut.Lock()
+	c.queue = q
+	c.mut.Unlock()
+	stop := context.AfterFunc(ctx, q.cancel)
+	defer stop()
+
+	w := newCacheWriter(c, q, len(paths))
+	q.workers.Go(w.run)
+
+	var workers sync.WaitGroup
+	for range runtime.NumCPU() {
+		workers.Go(func() {
+			c.cacheImages(q, w.results, stats, cached)
+		})
 	}
+	workers.Wait()
+	close(w.results)
+	q.workers.Wait()
 
-	return nil
+	c.mut.Lock()
+	if c.queue == q {
+		c.queue = nil
+	}
+	c.mut.Unlock()
+
+	c.ui.SetCacheProgress(1, "")
+	if err := w.failure(); err != nil {
+		c.ui.ShowErrorDialog(err)
+	}
+	return !q.isStopped()
 }
-func (c *Controller) dbinit(path string) error {
-	if c.db != nil {
-		c.db.Close()
+
+// stopCaching stops the background caching, if any, and waits for the images being cached.
+func (c *Controller) stopCaching() {
+	c.mut.Lock()
+	q := c.queue
+	c.queue = nil
+	c.mut.Unlock()
+
+	if q != nil {
+		q.stop()
 	}
+}
 
-	db, err := database.New(path)
+// PrioritizeImages caches paths before any other image waiting to be cached, in order. It is
+// meant for the images shown in the grid, the previous priorities are discarded.
+func (c *Controller) PrioritizeImages(paths []string) {
+	c.mut.Lock()
+	q := c.queue
+	c.mut.Unlock()
+
+	if q != nil {
+		q.prioritize(paths)
+	}
+}
+
+// cacheImage generates and stores the thumbnail and preview of an image. If the image was already
+// cached and its contents did not change only its file stats are updated, and false is returned.
+func (c *Controller) cacheImage(imgPath string, stat, cached data.FileStat, found bool) (bool, error) {
+	img, stat, err := c.generateImage(imgPath, stat, cached, found)
 	if err != nil {
-		log.Println("error opening database:", err)
-		return err
+		return false, err
 	}
 
-	c.db = db
-	return nil
-}
+	// the image is stored while the database can't be swapped, it was only read meanwhile
+	c.dbMut.Lock()
+	defer c.dbMut.Unlock()
+	if c.db == nil {
+		return false, errNoDataset
+	}
 
-func (c *Controller) cacheImages(total float64, processedCount *int64) {
-	defer c.wg.Done()
-	for imgPath := range c.jobs {
-		if _, found := c.getFromDBCache(imgPath); found {
-			atomic.AddInt64(processedCount, 1)
-			progress := float64(atomic.LoadInt64(processedCount)) / total
-			c.ui.SetProgress(progress, filepath.Base(imgPath))
-			continue
+	if img == nil {
+		if err := c.db.SetImageStat(imgPath, stat); err != nil {
+			return false, fmt.Errorf("could not update file stats of %s: %v", imgPath, err)
 		}
+		return false, nil
+	}
 
-		file, err := os.Open(imgPath)
-		if err != nil {
-			log.Printf("could not open file %s: %v", imgPath, err)
-			continue
-		}
+	if err := c.db.SetImages([]database.EncodedImage{*img}); err != nil {
+		return false, err
+	}
+	c.forgetImages(imgPath)
 
-		img, _, err := image.Decode(file)
-		_ = file.Close()
-		if err != nil {
-			log.Printf("could not decode image %s: %v", imgPath, err)
-			continue
-		}
+	return true, nil
+}
 
-		thumb := resize.Thumbnail(200, 200, img, resize.Lanczos3)
-		preview := resize.Thumbnail(800, 600, img, resize.Lanczos3)
-		//nolint:errcheck
-		c.db.SetImage(imgPath, database.CachedImage{
-			Thumbnail: thumb,
-			Preview:   preview,
-		})
+// generateImage reads an image and returns its thumbnail and preview encoded, along with its
+// stats including its hash. If the image was already cached and its contents did not change no
+// image is returned, only its stats need updating.
+func (c *Controller) generateImage(imgPath string, stat, cached data.FileStat, found bool) (*database.EncodedImage, data.FileStat, error) {
+	contents, err := os.ReadFile(imgPath)
+	if err != nil {
+		return nil, stat, fmt.Errorf("could not open file %s: %v", imgPath, err)
+	}
 
-		atomic.AddInt64(processedCount, 1)
-		progress := float64(atomic.LoadInt64(processedCount)) / total
-		c.ui.SetProgress(progress, filepath.Base(imgPath))
-		if !c.newCached {
-			c.mut.Lock()
-			c.newCached = true
-			c.mut.Unlock()
-		}
+	stat.Hash = data.HashContents(contents)
+	// images cached before hashes were recorded are trusted to be up to date
+	if found && (cached.Hash == "" || cached.Hash == stat.Hash) {
+		return nil, stat, nil
 	}
+
+	img, _, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, stat, fmt.Errorf("could not decode image %s: %v", imgPath, err)
+	}
+
+	c.mut.Lock()
+	config := c.cacheConfig
+	c.mut.Unlock()
+
+	thumb := resize.Thumbnail(config.ThumbnailSize, config.ThumbnailSize, img, config.Interpolation())
+	preview := resize.Thumbnail(config.PreviewWidth, config.PreviewHeight, img, config.Interpolation())
+	encoded, err := database.CachedImage{
+		Thumbnail: thumb,
+		Preview:   preview,
+		Stat:      stat,
+		Hashes:    data.NewPerceptualHashes(thumb),
+		Quality:   config.Quality,
+	}.Encode(imgPath)
+	if err != nil {
+		return nil, stat, err
+	}
+
+	return &encoded, stat, nil
 }
 
 func (c *Controller) GetImagePaths(binID int) []string {
@@ -150,35 +245,46 @@ func (c *Controller) GetImagePaths(binID int) []string {
 	return paths
 }
 
-// getCachedImage gets the image from the database cache for in memory caching
-func (c *Controller) getFromDBCache(path string) (database.CachedImage, bool) {
-	thumbFound := false
-	previewFound := false
-	img := database.CachedImage{}
-	if c.db != nil {
-		if thumb, found := c.db.GetThumbnail(path); found {
-			img.Thumbnail = thumb
-			thumbFound = true
-		}
-
-		if preview, found := c.db.GetPreview(path); found {
-			img.Preview = preview
-			previewFound = true
-		}
+// OpenDataset opens the dataset database without walking or caching the images,
+// used by clients that only need to read or export what is already sorted.
+func (c *Controller) OpenDataset(path string) error {
+	c.stopCaching()
+	c.StopWatching()
+	c.datasetRoot = path
+	if err := c.dbinit(path); err != nil {
+		return err
 	}
 
-	if thumbFound && previewFound {
-		return img, true
+	config, err := c.GetCacheConfig()
+	if err != nil {
+		return err
 	}
+	c.mut.Lock()
+	c.cacheConfig = config
+	c.mut.Unlock()
+
+	return nil
+}
+
+// Close releases the dataset database.
+func (c *Controller) Close() {
+	c.stopCaching()
+	c.StopWatching()
+	c.setDB(nil)
+	c.forgetAllImages()
+}
 
-	return img, false
+// LoadDataset opens and scans the dataset, caching new and changed images in the background.
+// Cancelling ctx stops loading and caching, the images cached until then are kept.
+func (c *Controller) LoadDataset(ctx context.Context, path string) {
+	c.loadDataset(ctx, path, false)
 }
 
-func (c *Controller) LoadDataset(path string) {
+// loadDataset opens and scans the dataset, caching new and changed images, or every image when
+// regenerate is set.
+func (c *Controller) loadDataset(ctx context.Context, path string, regenerate bool) {
 	c.ui.ShowProgressDialog("hang on, this may take a while...")
-	c.newCached = false
-	c.datasetRoot = path
-	if err := c.dbinit(path); err != nil {
+	if err := c.OpenDataset(path); err != nil {
 		c.ui.ShowErrorDialog(err)
 		return
 	}
@@ -188,177 +294,221 @@ func (c *Controller) LoadDataset(path string) {
 		c.ui.ShowErrorDialog(err)
 		return
 	}
+	if c.loadCancelled(ctx) {
+		return
+	}
 
-	imagePaths := d.Images
+	cached, err := c.db.GetImageStats()
+	if err != nil {
+		c.ui.ShowErrorDialog(err)
+		return
+	}
 
-	total := float64(len(imagePaths))
-	var processedCount int64
+	// missing images are kept when most of the dataset is, the dataset still loads from the cache
+	if _, err := c.pruneImages(d, cached, false); err != nil {
+		c.ui.ShowErrorDialog(err)
+		if !errors.Is(err, ErrMostImagesMissing) {
+			return
+		}
+	}
 
-	c.jobs = make(chan string, len(imagePaths))
-	for _, p := range imagePaths {
-		c.jobs <- p
+	stale, err := c.cacheStale()
+	if err != nil {
+		c.ui.ShowErrorDialog(err)
+		return
+	}
+	if stale && len(cached) > 0 {
+		log.Printf("cache settings changed, regenerating %d images", len(cached))
 	}
-	close(c.jobs)
+	regenerate = regenerate || stale
 
-	c.wg = &sync.WaitGroup{}
-	numWorkers := runtime.NumCPU()
-	c.wg.Add(numWorkers)
+	// only new images and images whose size or modification time changed need caching
+	var imagePaths []string
+	for _, path := range d.Images {
+		if old, found := cached[path]; regenerate || !found || !old.SameFile(d.Stats[path]) {
+			imagePaths = append(imagePaths, path)
+		}
+	}
+	oldStats := cached
+	if regenerate {
+		// forgetting the cached stats makes every image decoded again, bins are kept
+		cached = make(map[string]data.FileStat)
+	}
 
-	for range numWorkers {
-		go c.cacheImages(total, &processedCount)
+	if err := c.hashCachedImages(ctx); err != nil {
+		if !c.loadCancelled(ctx) {
+			c.ui.ShowErrorDialog(err)
+		}
+		return
+	}
+
+	// new images are shown right away with a placeholder until they are cached
+	var pending []string
+	for _, path := range imagePaths {
+		if _, found := oldStats[path]; !found {
+			pending = append(pending, path)
+		}
+	}
+	if err := c.db.AddPendingImages(pending); err != nil {
+		c.ui.ShowErrorDialog(err)
+		return
 	}
-	c.wg.Wait()
 
 	c.ui.LoadContent()
-}
+	if len(imagePaths) == 0 && !regenerate {
+		return
+	}
 
-func (c *Controller) ExportDataset(dest string, balanced bool) {
-	if dest == c.datasetRoot {
-		c.ui.ShowErrorDialog(errInvalidDestination)
+	if !c.cacheInBackground(ctx, imagePaths, d.Stats, cached) {
 		return
 	}
 
-	c.ui.ShowProgressDialog("hang on, this may take a while...")
-	defer c.ui.HideProgressDialog()
+	if regenerate {
+		if err := c.setCacheConfig(builtCacheConfigKey, c.cacheConfig); err != nil {
+			c.ui.ShowErrorDialog(err)
+		}
+	}
+}
 
-	datasetRoot := filepath.Join(dest, "dataset_export")
-	if balanced {
-		datasetRoot = filepath.Join(dest, "balanced_export")
+// loadCancelled reports whether loading was cancelled before the dataset was scanned, the dataset
+// is then shown as it was cached until now and picked up where it was left on the next load.
+func (c *Controller) loadCancelled(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
 	}
 
-	if err := os.MkdirAll(datasetRoot, 0755); err != nil {
-		c.ui.ShowErrorDialog(err)
-		return
+	log.Printf("loading %s cancelled", c.datasetRoot)
+	c.ui.LoadContent()
+	return true
+}
+
+// GetThumbnail returns the thumbnail of the image at path, nil if it is not cached yet.
+// Recently shown thumbnails are kept decoded in memory.
+func (c *Controller) GetThumbnail(path string) image.Image {
+	c.dbMut.RLock()
+	defer c.dbMut.RUnlock()
+	if c.db == nil {
+		return nil
 	}
+	return c.getImage(path, c.thumbnails, c.db.GetThumbnail)
+}
 
-	binCount := c.ui.GetBinCount()
+// GetPreview returns the preview of the image at path, nil if it is not cached yet.
+// Recently shown previews are kept decoded in memory.
+func (c *Controller) GetPreview(path string) image.Image {
+	c.dbMut.RLock()
+	defer c.dbMut.RUnlock()
+	if c.db == nil {
+		return nil
+	}
+	return c.getImage(path, c.previews, c.db.GetPreview)
+}
 
-	if balanced {
-		imgCount, err := c.db.GetLowestImageCount()
-		if err != nil {
-			c.ui.ShowErrorDialog(err)
-			return
-		}
-		if imgCount == 0 {
-			message := errors.New("no images found in bins to create a balanced export")
-			c.ui.ShowErrorDialog(message)
-			return
-		}
+func (c *Controller) getImage(path string, memory *imageCache, load func(string) (image.Image, bool)) image.Image {
+	if img, ok := memory.get(path); ok {
+		return img
+	}
 
-		trainCount := int(float64(imgCount) * 0.6)
-		validationCount := int(float64(imgCount) * 0.2)
-		testCount := int(float64(imgCount) * 0.2)
+	version := memory.startLoad(path)
+	img, ok := load(path)
+	if !ok {
+		img = nil
+	}
 
-		splitCounts := map[string]int{
-			"training":   trainCount,
-			"validation": validationCount,
-			"test":       testCount,
-		}
+	memory.finishLoad(path, img, version)
+	return img
+}
 
-		for splitName := range splitCounts {
-			if err := os.MkdirAll(filepath.Join(datasetRoot, splitName), 0755); err != nil {
-				c.ui.ShowErrorDialog(err)
-				return
-			}
-		}
+// PrefetchImages decodes the thumbnails and previews of paths in the background, usually the
+// neighbors of the highlighted image, so they show right away once selected. A new request
+// replaces the one not started yet.
+func (c *Controller) PrefetchImages(paths []string) {
+	select {
+	case <-c.prefetch:
+	default:
+	}
 
-		for i := range binCount {
-			if i <= 0 {
-				continue
-			}
-
-			imgPaths, err := c.db.GetImagePaths(i)
-			if err != nil {
-				message := fmt.Errorf("error getting image paths for bin %d: %v", i, err)
-				c.ui.ShowErrorDialog(message)
-				return
-			}
-
-			if len(imgPaths) < imgCount {
-				message := fmt.Errorf("not enough images for balanced export on bin %d", i)
-				c.ui.ShowErrorDialog(message)
-				continue
-			}
-
-			rand.Shuffle(len(imgPaths), func(j, k int) {
-				imgPaths[j], imgPaths[k] = imgPaths[k], imgPaths[j]
-			})
-
-			for splitName := range splitCounts {
-				if err := os.MkdirAll(filepath.Join(datasetRoot, splitName, fmt.Sprint(i)), 0755); err != nil {
-					c.ui.ShowErrorDialog(err)
-					return
-				}
-			}
-
-			// Select and copy images
-			start := 0
-			if err := c.copyImages(imgPaths[start:start+trainCount], filepath.Join(datasetRoot, "training"), i); err != nil {
-				c.ui.ShowErrorDialog(err)
-				return
-			}
-			start += trainCount
-
-			if err := c.copyImages(imgPaths[start:start+validationCount], filepath.Join(datasetRoot, "validation"), i); err != nil {
-				c.ui.ShowErrorDialog(err)
-				return
-			}
-			start += validationCount
-
-			if err := c.copyImages(imgPaths[start:start+testCount], filepath.Join(datasetRoot, "test"), i); err != nil {
-				c.ui.ShowErrorDialog(err)
-				return
-			}
-		}
-		return
+	select {
+	case c.prefetch <- paths:
+	default:
 	}
+}
 
-	for i := range binCount {
-		if i == -1 {
-			continue
-		}
-		imgPaths, err := c.db.GetImagePaths(i)
-		if err != nil {
-			log.Println("error getting image paths:", err)
-			c.ui.ShowErrorDialog(err)
-			return
-		}
-		err = c.copyImages(imgPaths, datasetRoot, i)
-		if err != nil {
-			c.ui.ShowErrorDialog(err)
-			return
+func (c *Controller) prefetchImages() {
+	for paths := range c.prefetch {
+		for _, path := range paths {
+			c.GetThumbnail(path)
+			c.GetPreview(path)
 		}
 	}
 }
 
-func (c *Controller) GetThumbnail(path string) image.Image {
-	if img, ok := c.db.GetThumbnail(path); ok {
-		return img
+// forgetImages drops the decoded images of paths, after they were recached, moved or removed.
+func (c *Controller) forgetImages(paths ...string) {
+	for _, path := range paths {
+		c.thumbnails.remove(path)
+		c.previews.remove(path)
 	}
+}
 
-	return nil
+func (c *Controller) forgetAllImages() {
+	c.thumbnails.clear()
+	c.previews.clear()
 }
 
-// Getthumbnail to be used by controller clients and retrieve the preview from the in memory cache
-func (c *Controller) GetPreview(path string) image.Image {
-	if img, ok := c.db.GetPreview(path); ok {
-		return img
+// GetOriginal decodes the image file at path at full resolution. The file is only ever read.
+func (c *Controller) GetOriginal(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open file %s: %v", path, err)
 	}
+	//nolint:errcheck
+	defer f.Close()
 
-	return nil
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode image %s: %v", path, err)
+	}
+
+	return img, nil
+}
+
+// GetBinCounts returns the number of images in each bin of the open dataset.
+func (c *Controller) GetBinCounts() (map[int]int, error) {
+	if c.db == nil {
+		return nil, errNoDataset
+	}
+
+	return c.db.GetBinCounts()
 }
 
 func (c *Controller) MoveImages(paths []string, sourceID, destID int) error {
-	if sourceID == destID || destID > c.ui.GetBinCount() {
+	if sourceID == destID {
 		return nil
 	}
 
+	if destID != -1 {
+		layout, err := c.GetBinLayout()
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(layout, destID) {
+			return nil
+		}
+	}
+
 	return c.db.UpdateImages(paths, sourceID, destID)
 }
 
 func New(ui CoreUI) *Controller {
-	return &Controller{
-		ui:  ui,
-		mut: &sync.Mutex{},
+	c := &Controller{
+		ui:         ui,
+		mut:        &sync.Mutex{},
+		thumbnails: newImageCache(thumbnailMemory),
+		previews:   newImageCache(previewMemory),
+		prefetch:   make(chan []string, 1),
 	}
+	go c.prefetchImages()
+
+	return c
 }
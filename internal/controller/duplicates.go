@@ -0,0 +1,52 @@
+package controller
+
+import "slices"
+
+// GetDuplicates returns the groups of images in the dataset with byte-identical contents.
+func (c *Controller) GetDuplicates() ([][]string, error) {
+	if c.db == nil {
+		return nil, errNoDataset
+	}
+
+	return c.db.GetDuplicates()
+}
+
+// GetImageBins returns the bins an image is in.
+func (c *Controller) GetImageBins(path string) ([]int, error) {
+	if c.db == nil {
+		return nil, errNoDataset
+	}
+
+	return c.db.GetImageBins([]string{path})
+}
+
+// ExcludeDuplicates keeps one image of each group of duplicates or near-duplicates and excludes
+// the others. The image kept is the first one found in a sorting bin, or the first one otherwise.
+func (c *Controller) ExcludeDuplicates(groups [][]string) error {
+	if c.db == nil {
+		return errNoDataset
+	}
+
+	var copies []string
+	for _, group := range groups {
+		keep := 0
+		for i, path := range group {
+			bins, err := c.db.GetImageBins([]string{path})
+			if err != nil {
+				return err
+			}
+			if slices.ContainsFunc(bins, func(id int) bool { return id > 0 }) {
+				keep = i
+				break
+			}
+		}
+
+		for i, path := range group {
+			if i != keep {
+				copies = append(copies, path)
+			}
+		}
+	}
+
+	return c.db.ExcludeImages(copies)
+}
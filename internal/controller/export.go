@@ -0,0 +1,604 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+const (
+	splitConfigKey   = "split_config"
+	splitSeedKey     = "split_seed"
+	classWeightsFile = "class_weights.json"
+)
+
+var (
+	errInvalidDestination = errors.New("cannot export dataset to the same location, please choose a different destination")
+)
+
+// ExportMode selects how ExportDataset lays out the exported dataset.
+type ExportMode int
+
+const (
+	// ExportFolders copies every bin into its own folder.
+	ExportFolders ExportMode = iota
+	// ExportBalanced downsamples every bin to the smallest one and splits them
+	// following the dataset split configuration.
+	ExportBalanced
+	// ExportStratified splits every bin following the dataset split configuration
+	// without discarding any image.
+	ExportStratified
+)
+
+var exportDirs = map[ExportMode]string{
+	ExportFolders:    "dataset_export",
+	ExportBalanced:   "balanced_export",
+	ExportStratified: "stratified_export",
+}
+
+type ExportOptions struct {
+	Mode ExportMode
+	// PinSplits pins every exported image to the split it landed in, so it stays there
+	// on later exports even as the dataset grows.
+	PinSplits bool
+	// Oversample duplicates the training images of the smaller bins until they match
+	// the largest one, only used by stratified exports.
+	Oversample bool
+	// ClassWeights writes the weight of each bin, computed from the training images,
+	// to class_weights.json, only used by stratified exports.
+	ClassWeights bool
+	// KeepClusters puts every cluster of near-duplicate images, as grouped by the dataset
+	// near-duplicate configuration, in a single split so they don't leak between splits.
+	KeepClusters bool
+}
+
+// copyImages copies imgPaths into the bin folder of splitName in the export, skipping the images
+// an earlier export already copied. names are the bin names, as returned by GetBinNames. It stops
+// between files once ctx is cancelled, returning its error.
+func (c *Controller) copyImages(ctx context.Context, m *exportManifest, names map[int]string, imgPaths []string, splitName string, binID int) error {
+	total := float64(len(imgPaths))
+	var copiedCount int64
+	var failedCopy []string
+
+	binFolder := binFolderName(names, binID)
+	destinationDir := filepath.Join(m.root, splitName, binFolder)
+	err := os.Mkdir(destinationDir, 0755)
+	if err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	for _, imgPath := range imgPaths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		fileName := c.exportName(imgPath)
+		if err := c.exportImage(m, imgPath, splitName, binID, binFolder, fileName); err != nil {
+			log.Println(err)
+			failedCopy = append(failedCopy, fileName)
+			continue
+		}
+		atomic.AddInt64(&copiedCount, 1)
+		progress := float64(atomic.LoadInt64(&copiedCount)) / total
+		c.ui.SetProgress(progress, filepath.Join(binFolder, fileName))
+	}
+
+	if len(failedCopy) > 0 {
+		return fmt.Errorf("failed to copy %d files, check logfile for more details", len(failedCopy))
+	}
+
+	return nil
+}
+
+// oversampleImages copies count duplicates of imgPaths into the bin folder, cycling through them
+// and suffixing the file names. Names of images in the bin folder, or of files another export put
+// in it, are skipped, so duplicates never overwrite them.
+func (c *Controller) oversampleImages(ctx context.Context, m *exportManifest, names map[int]string, imgPaths []string, splitName string, binID, count int) error {
+	if len(imgPaths) == 0 || count <= 0 {
+		return nil
+	}
+
+	var failedCopy []string
+	binFolder := binFolderName(names, binID)
+	taken := make(map[string]bool)
+	for _, imgPath := range imgPaths {
+		taken[c.exportName(imgPath)] = true
+	}
+	for j := range count {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		imgPath := imgPaths[j%len(imgPaths)]
+		fileName := c.exportName(imgPath)
+		ext := filepath.Ext(fileName)
+		var dupName string
+		for n := j/len(imgPaths) + 1; ; n++ {
+			dupName = fmt.Sprintf("%s_dup%d%s", strings.TrimSuffix(fileName, ext), n, ext)
+			dest := filepath.ToSlash(filepath.Join(splitName, binFolder, dupName))
+			if !taken[dupName] && !m.occupied(dest, imgPath) {
+				break
+			}
+		}
+		taken[dupName] = true
+
+		if err := c.exportImage(m, imgPath, splitName, binID, binFolder, dupName); err != nil {
+			log.Println(err)
+			failedCopy = append(failedCopy, fileName)
+			continue
+		}
+		c.ui.SetProgress(float64(j+1)/float64(count), filepath.Join(binFolder, dupName))
+	}
+
+	if len(failedCopy) > 0 {
+		return fmt.Errorf("failed to oversample %d files, check logfile for more details", len(failedCopy))
+	}
+
+	return nil
+}
+
+// exportImage copies the image at imgPath as fileName into binFolder, the folder of bin binID in
+// splitName, and records it in the manifest, unless an earlier export already copied it there.
+func (c *Controller) exportImage(m *exportManifest, imgPath, splitName string, binID int, binFolder, fileName string) error {
+	dest := filepath.ToSlash(filepath.Join(splitName, binFolder, fileName))
+	if m.exported(imgPath, dest) {
+		return nil
+	}
+
+	info, err := os.Stat(imgPath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	img, err := os.ReadFile(imgPath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+	destPath := filepath.Join(m.root, filepath.FromSlash(dest))
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+	if err := writeFile(destPath, img); err != nil {
+		return fmt.Errorf("failed to write file to destination: %v", err)
+	}
+
+	return m.record(manifestEntry{
+		Source:     imgPath,
+		Dest:       dest,
+		Bin:        binID,
+		Split:      splitName,
+		Size:       int64(len(img)),
+		ModTime:    info.ModTime().UnixNano(),
+		Hash:       data.HashContents(img),
+		ExportedAt: time.Now().UTC(),
+	})
+}
+
+// exportName returns the name the image at imgPath is exported as in its bin folder, its path
+// relative to the dataset, so images of different subfolders with the same name don't overwrite
+// each other.
+func (c *Controller) exportName(imgPath string) string {
+	rel, err := filepath.Rel(c.datasetRoot, imgPath)
+	if err != nil || !filepath.IsLocal(rel) {
+		return filepath.Base(imgPath)
+	}
+
+	return rel
+}
+
+// writeFile writes contents to a temporary file next to path and renames it into place, so an
+// interrupted export never leaves a partially written image behind.
+func writeFile(path string, contents []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), ".picsort-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		//nolint:errcheck
+		os.Remove(f.Name())
+	}
+
+	return err
+}
+
+// shuffleImages shuffles paths in place. Paths are sorted first so the same seed always
+// gives the same order, each bin gets its own stream so changes in one bin don't move
+// the others, and pinned images are kept first so downsampling never drops them.
+func shuffleImages(paths []string, seed uint64, binID int, pins map[string]string) {
+	slices.Sort(paths)
+	r := rand.New(rand.NewPCG(seed, uint64(binID)))
+	r.Shuffle(len(paths), func(j, k int) {
+		paths[j], paths[k] = paths[k], paths[j]
+	})
+
+	slices.SortStableFunc(paths, func(a, b string) int {
+		_, pinnedA := pins[a]
+		_, pinnedB := pins[b]
+		switch {
+		case pinnedA && !pinnedB:
+			return -1
+		case !pinnedA && pinnedB:
+			return 1
+		default:
+			return 0
+		}
+	})
+}
+
+// trainingSplits returns the splits models are trained on, which are the ones class weights
+// apply to. Folds are included, each of them is trained on when it is not the one validating.
+func trainingSplits(split data.SplitConfig) []string {
+	var names []string
+	for _, name := range split.Splits() {
+		if name != data.SplitValidation && name != data.SplitTest {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// exportSplits splits every bin following the dataset split configuration into
+// the export, downsampling each bin to limit images when limit is greater than 0. Splits are
+// only pinned once every image was exported.
+func (c *Controller) exportSplits(ctx context.Context, m *exportManifest, names map[int]string, layout []int, limit int, opts ExportOptions) error {
+	split, err := c.GetSplitConfig()
+	if err != nil {
+		return err
+	}
+
+	seed, err := c.GetSplitSeed()
+	if err != nil {
+		return err
+	}
+
+	pins, err := c.db.GetSplitPins()
+	if err != nil {
+		return err
+	}
+
+	// clusterSplits holds the split given to each cluster, so images of a cluster found in
+	// later bins follow it
+	clusterOf := make(map[string]int)
+	clusterSplits := make(map[int]string)
+	if opts.KeepClusters {
+		config, err := c.GetClusterConfig()
+		if err != nil {
+			return err
+		}
+		clusters, err := c.GetNearDuplicates(config)
+		if err != nil {
+			return err
+		}
+		for id, cluster := range clusters {
+			for _, path := range cluster {
+				clusterOf[path] = id
+			}
+		}
+	}
+
+	binSplits := make(map[int]map[string][]string)
+	var binIDs []int
+	for _, i := range layout {
+		if i <= 0 {
+			continue
+		}
+
+		imgPaths, err := c.db.GetImagePaths(i)
+		if err != nil {
+			return fmt.Errorf("error getting image paths for bin %d: %v", i, err)
+		}
+
+		// empty bins are not part of the export, they hold no class to train on
+		if len(imgPaths) == 0 {
+			continue
+		}
+		if len(imgPaths) < limit {
+			message := fmt.Errorf("not enough images for balanced export on bin %d", i)
+			c.ui.ShowErrorDialog(message)
+			continue
+		}
+
+		shuffleImages(imgPaths, seed, i, pins)
+		if limit > 0 {
+			imgPaths = imgPaths[:limit]
+		}
+
+		if !opts.KeepClusters {
+			binSplits[i] = split.SplitPinned(imgPaths, pins)
+			binIDs = append(binIDs, i)
+			continue
+		}
+
+		binPins := maps.Clone(pins)
+		for _, path := range imgPaths {
+			id, clustered := clusterOf[path]
+			if _, pinned := pins[path]; !clustered || pinned {
+				continue
+			}
+			if splitName, found := clusterSplits[id]; found {
+				binPins[path] = splitName
+			}
+		}
+		binSplits[i] = split.SplitClustered(imgPaths, clusterOf, binPins)
+		for splitName, paths := range binSplits[i] {
+			for _, path := range paths {
+				if id, clustered := clusterOf[path]; clustered {
+					clusterSplits[id] = splitName
+				}
+			}
+		}
+		binIDs = append(binIDs, i)
+	}
+
+	for _, splitName := range split.Splits() {
+		if err := os.MkdirAll(filepath.Join(m.root, splitName), 0755); err != nil {
+			return err
+		}
+	}
+
+	newPins := make(map[string]string)
+	for _, i := range binIDs {
+		for _, splitName := range split.Splits() {
+			if err := c.copyImages(ctx, m, names, binSplits[i][splitName], splitName, i); err != nil {
+				return err
+			}
+			for _, path := range binSplits[i][splitName] {
+				newPins[path] = splitName
+			}
+		}
+	}
+
+	if opts.Mode == ExportStratified && opts.ClassWeights {
+		if err := writeClassWeights(m.root, names, split, binIDs, binSplits); err != nil {
+			return fmt.Errorf("failed to write class weights: %v", err)
+		}
+	}
+
+	// folds also validate, duplicates in them would leak into validation, so only the training
+	// split is oversampled
+	if opts.Mode == ExportStratified && opts.Oversample && slices.Contains(split.Splits(), data.SplitTraining) {
+		target := 0
+		for _, i := range binIDs {
+			target = max(target, len(binSplits[i][data.SplitTraining]))
+		}
+		for _, i := range binIDs {
+			imgPaths := binSplits[i][data.SplitTraining]
+			if err := c.oversampleImages(ctx, m, names, imgPaths, data.SplitTraining, i, target-len(imgPaths)); err != nil {
+				return err
+			}
+		}
+	} else if opts.Mode == ExportStratified && opts.Oversample {
+		log.Println("not oversampling, folds are also used for validation")
+	}
+
+	if opts.PinSplits {
+		if err := c.db.PinSplits(newPins); err != nil {
+			return fmt.Errorf("failed to pin split assignments: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// writeClassWeights writes the inverse frequency weight of each bin in the training
+// splits, so that every bin contributes equally to the loss. Bins without training images
+// are no class of the training data and get no weight.
+func writeClassWeights(datasetRoot string, names map[int]string, split data.SplitConfig, binIDs []int, binSplits map[int]map[string][]string) error {
+	counts := make(map[int]int)
+	total := 0
+	for _, i := range binIDs {
+		count := 0
+		for _, splitName := range trainingSplits(split) {
+			count += len(binSplits[i][splitName])
+		}
+		if count == 0 {
+			continue
+		}
+		counts[i] = count
+		total += count
+	}
+
+	weights := make(map[string]float64)
+	for i, count := range counts {
+		weights[binFolderName(names, i)] = float64(total) / float64(len(counts)*count)
+	}
+
+	content, err := json.MarshalIndent(weights, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(datasetRoot, classWeightsFile), content, 0644)
+}
+
+// ExportDataset copies the sorted images into a folder under dest laid out following opts. The
+// copied images are recorded in the manifest of the folder, so exporting again only copies the
+// images that changed, nothing is ever removed from the folder. Cancelling ctx stops it between
+// files, the next export to the same destination resumes from there.
+func (c *Controller) ExportDataset(ctx context.Context, dest string, opts ExportOptions) {
+	if dest == c.datasetRoot {
+		c.ui.ShowErrorDialog(errInvalidDestination)
+		return
+	}
+
+	c.ui.ShowProgressDialog("hang on, this may take a while...")
+	defer c.ui.HideProgressDialog()
+
+	if err := c.exportDataset(ctx, dest, opts); err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Printf("export to %s cancelled", dest)
+			return
+		}
+		c.ui.ShowErrorDialog(err)
+	}
+}
+
+func (c *Controller) exportDataset(ctx context.Context, dest string, opts ExportOptions) error {
+	datasetRoot := filepath.Join(dest, exportDirs[opts.Mode])
+	if err := os.MkdirAll(datasetRoot, 0755); err != nil {
+		return err
+	}
+
+	layout, err := c.GetBinLayout()
+	if err != nil {
+		return err
+	}
+
+	names, err := c.GetBinNames()
+	if err != nil {
+		return err
+	}
+
+	m, err := openManifest(datasetRoot)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck
+	defer m.close()
+
+	if opts.Mode == ExportFolders {
+		for _, i := range layout {
+			imgPaths, err := c.db.GetImagePaths(i)
+			if err != nil {
+				log.Println("error getting image paths:", err)
+				return err
+			}
+			if err := c.copyImages(ctx, m, names, imgPaths, "", i); err != nil {
+				return err
+			}
+		}
+		return m.finish()
+	}
+
+	limit := 0
+	if opts.Mode == ExportBalanced {
+		imgCount, err := c.db.GetLowestImageCount()
+		if err != nil {
+			return err
+		}
+		if imgCount == 0 {
+			return errors.New("no images found in bins to create a balanced export")
+		}
+		limit = imgCount
+	}
+
+	if err := c.exportSplits(ctx, m, names, layout, limit, opts); err != nil {
+		return err
+	}
+
+	return m.finish()
+}
+
+// GetSplitConfig returns the split ratios stored in the dataset, or the default
+// 60/20/20 split if none were chosen yet.
+func (c *Controller) GetSplitConfig() (data.SplitConfig, error) {
+	split := data.DefaultSplitConfig()
+	if c.db == nil {
+		return split, nil
+	}
+
+	value, err := c.db.GetMetadata(splitConfigKey)
+	if err != nil || value == "" {
+		return split, err
+	}
+
+	if err := json.Unmarshal([]byte(value), &split); err != nil {
+		return split, fmt.Errorf("invalid split configuration stored in dataset: %v", err)
+	}
+
+	return split, nil
+}
+
+// SetSplitConfig validates and stores the split ratios in the dataset so later exports
+// use the same split.
+func (c *Controller) SetSplitConfig(split data.SplitConfig) error {
+	if err := split.Validate(); err != nil {
+		return err
+	}
+	if c.db == nil {
+		return errNoDataset
+	}
+
+	value, err := json.Marshal(split)
+	if err != nil {
+		return err
+	}
+
+	return c.db.SetMetadata(splitConfigKey, string(value))
+}
+
+// GetSplitSeed returns the seed used to shuffle images before splitting them. A random
+// seed is generated and stored the first time, so every export of the same bins
+// produces the same split until the seed is changed.
+func (c *Controller) GetSplitSeed() (uint64, error) {
+	seed, stored, err := c.SuggestSplitSeed()
+	if err != nil || stored {
+		return seed, err
+	}
+
+	return seed, c.SetSplitSeed(seed)
+}
+
+// SuggestSplitSeed returns the seed stored in the dataset, or a new random seed when none
+// was stored yet, without storing it. stored reports which one it is.
+func (c *Controller) SuggestSplitSeed() (seed uint64, stored bool, err error) {
+	if c.db == nil {
+		return 0, false, errNoDataset
+	}
+
+	value, err := c.db.GetMetadata(splitSeedKey)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if value == "" {
+		return rand.Uint64(), false, nil
+	}
+
+	seed, err = strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid split seed stored in dataset: %v", err)
+	}
+	return seed, true, nil
+}
+
+func (c *Controller) SetSplitSeed(seed uint64) error {
+	if c.db == nil {
+		return errNoDataset
+	}
+
+	return c.db.SetMetadata(splitSeedKey, strconv.FormatUint(seed, 10))
+}
+
+// ClearSplitPins unpins all images, letting them be split freely on the next export.
+func (c *Controller) ClearSplitPins() error {
+	if c.db == nil {
+		return errNoDataset
+	}
+
+	return c.db.ClearSplitPins()
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"errors"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// historyLimit is the number of operations shown in the history.
+const historyLimit = 100
+
+var errInvalidAddBin = errors.New("images can only be added to sorting bins")
+
+// AddImagesToBin adds images to a bin while keeping them in the bins they already are in.
+func (c *Controller) AddImagesToBin(paths []string, destID int) error {
+	if c.db == nil {
+		return errNoDataset
+	}
+	if destID <= 0 {
+		return errInvalidAddBin
+	}
+
+	return c.db.AddImagesToBin(paths, destID)
+}
+
+// Undo reverts the last sorting operation, it returns false when there is nothing to undo.
+func (c *Controller) Undo() (data.HistoryEntry, bool, error) {
+	if c.db == nil {
+		return data.HistoryEntry{}, false, errNoDataset
+	}
+
+	return c.db.Undo()
+}
+
+// Redo applies again the last undone operation, it returns false when there is nothing to redo.
+func (c *Controller) Redo() (data.HistoryEntry, bool, error) {
+	if c.db == nil {
+		return data.HistoryEntry{}, false, errNoDataset
+	}
+
+	return c.db.Redo()
+}
+
+// GetHistory returns the most recent sorting operations, most recent first.
+func (c *Controller) GetHistory() ([]data.HistoryEntry, error) {
+	if c.db == nil {
+		return nil, errNoDataset
+	}
+
+	return c.db.GetHistory(historyLimit)
+}
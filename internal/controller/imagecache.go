@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"container/list"
+	"image"
+	"sync"
+)
+
+const (
+	// thumbnailMemory and previewMemory bound the memory taken by the decoded thumbnails and
+	// previews kept around, the least recently used ones are dropped first.
+	thumbnailMemory = 64 << 20
+	previewMemory   = 128 << 20
+)
+
+// imageCache is a concurrency safe LRU cache of decoded images, bounded by the memory their
+// pixels take, so scrolling back and forth doesn't query and decode the same images again.
+type imageCache struct {
+	mut   sync.Mutex
+	limit int64
+	size  int64
+	items map[string]*list.Element
+	// order holds the most recently used images first
+	order *list.List
+	// version counts the times images were dropped, cleared is the version of the last time every
+	// image was. Images loaded meanwhile are not stored over newer ones.
+	version uint64
+	cleared uint64
+	// loading counts the loads in flight of each image, dropped holds the version the images
+	// being loaded were last dropped at.
+	loading map[string]int
+	dropped map[string]uint64
+}
+
+type imageCacheEntry struct {
+	path string
+	img  image.Image
+	size int64
+}
+
+func newImageCache(limit int64) *imageCache {
+	return &imageCache{
+		limit:   limit,
+		items:   make(map[string]*list.Element),
+		order:   list.New(),
+		loading: make(map[string]int),
+		dropped: make(map[string]uint64),
+	}
+}
+
+func (c *imageCache) get(path string) (image.Image, bool) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	e, ok := c.items[path]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(e)
+	return e.Value.(*imageCacheEntry).img, true
+}
+
+// startLoad records that the image at path is being loaded and returns the version it is loaded
+// at, to be handed to finishLoad.
+func (c *imageCache) startLoad(path string) uint64 {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.loading[path]++
+	return c.version
+}
+
+// finishLoad stores img, loaded at version, dropping the least recently used images until it fits
+// in the limit. A nil img only ends the load. Images larger than the limit, or dropped since they
+// started loading, are not stored.
+func (c *imageCache) finishLoad(path string, img image.Image, version uint64) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	stale := version < c.cleared || version < c.dropped[path]
+	if c.loading[path]--; c.loading[path] <= 0 {
+		delete(c.loading, path)
+		delete(c.dropped, path)
+	}
+	if img == nil || stale {
+		return
+	}
+
+	size := imageMemory(img)
+	if size > c.limit {
+		return
+	}
+
+	if e, ok := c.items[path]; ok {
+		c.removeElement(e)
+	}
+
+	c.items[path] = c.order.PushFront(&imageCacheEntry{path: path, img: img, size: size})
+	c.size += size
+	for c.size > c.limit {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// remove drops the image at path, leaving the other images and their loads alone.
+func (c *imageCache) remove(path string) {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.version++
+	if c.loading[path] > 0 {
+		c.dropped[path] = c.version
+	}
+	if e, ok := c.items[path]; ok {
+		c.removeElement(e)
+	}
+}
+
+func (c *imageCache) clear() {
+	c.mut.Lock()
+	defer c.mut.Unlock()
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+	c.size = 0
+	c.version++
+	c.cleared = c.version
+}
+
+func (c *imageCache) removeElement(e *list.Element) {
+	entry := c.order.Remove(e).(*imageCacheEntry)
+	delete(c.items, entry.path)
+	c.size -= entry.size
+}
+
+// imageMemory returns roughly how many bytes the pixels of img take.
+func imageMemory(img image.Image) int64 {
+	switch i := img.(type) {
+	case *image.YCbCr:
+		return int64(len(i.Y) + len(i.Cb) + len(i.Cr))
+	case *image.Gray:
+		return int64(len(i.Pix))
+	case *image.RGBA:
+		return int64(len(i.Pix))
+	case *image.NRGBA:
+		return int64(len(i.Pix))
+	default:
+		bounds := img.Bounds()
+		return int64(bounds.Dx()) * int64(bounds.Dy()) * 4
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/coolapso/picsort/internal/database"
+)
+
+func TestImageCacheDropsOnlyChangedImages(t *testing.T) {
+	c := newImageCache(thumbnailMemory)
+	img := image.NewGray(image.Rect(0, 0, 8, 8))
+
+	a, b := c.startLoad("a.jpg"), c.startLoad("b.jpg")
+	c.remove("a.jpg")
+	c.finishLoad("a.jpg", img, a)
+	c.finishLoad("b.jpg", img, b)
+	if _, ok := c.get("a.jpg"); ok {
+		t.Error("a.jpg loaded before it was dropped was stored")
+	}
+	if _, ok := c.get("b.jpg"); !ok {
+		t.Error("b.jpg was not stored after another image was dropped")
+	}
+
+	a = c.startLoad("a.jpg")
+	c.finishLoad("a.jpg", img, a)
+	if _, ok := c.get("a.jpg"); !ok {
+		t.Error("a.jpg loaded after it was dropped was not stored")
+	}
+	if len(c.loading) != 0 || len(c.dropped) != 0 {
+		t.Errorf("loads still tracked after finishing: %v, %v", c.loading, c.dropped)
+	}
+
+	b = c.startLoad("b.jpg")
+	c.clear()
+	c.finishLoad("b.jpg", img, b)
+	if _, ok := c.get("b.jpg"); ok {
+		t.Error("b.jpg loaded before the cache was cleared was stored")
+	}
+}
+
+// newBenchmarkController opens a dataset in a temporary folder holding a single cached image,
+// with a thumbnail and preview of the default sizes, and returns the path of the image.
+func newBenchmarkController(b *testing.B) (*Controller, string) {
+	b.Helper()
+	root := b.TempDir()
+	db, err := database.New(root, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	c := New(nil)
+	c.setDB(db)
+	b.Cleanup(c.Close)
+
+	path := filepath.Join(root, "image.jpg")
+	img, err := database.CachedImage{Thumbnail: benchmarkImage(200, 150), Preview: benchmarkImage(800, 600)}.Encode(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := db.SetImages([]database.EncodedImage{img}); err != nil {
+		b.Fatal(err)
+	}
+
+	return c, path
+}
+
+func benchmarkImage(width, height int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x * y), A: 255})
+		}
+	}
+	return img
+}
+
+func BenchmarkGetImage(b *testing.B) {
+	c, path := newBenchmarkController(b)
+	for _, kind := range []struct {
+		name string
+		get  func(string) image.Image
+	}{
+		{"thumbnail", c.GetThumbnail},
+		{"preview", c.GetPreview},
+	} {
+		b.Run(kind.name+"/warm", func(b *testing.B) {
+			kind.get(path)
+			for b.Loop() {
+				kind.get(path)
+			}
+		})
+		b.Run(kind.name+"/cold", func(b *testing.B) {
+			for b.Loop() {
+				c.forgetImages(path)
+				kind.get(path)
+			}
+		})
+	}
+}
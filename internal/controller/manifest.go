@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// manifestFile records every image an export copied, one JSON entry per line.
+const manifestFile = "manifest.jsonl"
+
+// manifestEntry records an image copied by an export. Dest is relative to the export folder and
+// slash separated, Hash is the sha256 of the copied contents and ModTime the modification time of
+// the source when it was copied, in nanoseconds.
+type manifestEntry struct {
+	Source     string    `json:"source"`
+	Dest       string    `json:"dest"`
+	Bin        int       `json:"bin"`
+	Split      string    `json:"split,omitempty"`
+	Size       int64     `json:"size"`
+	ModTime    int64     `json:"mod_time"`
+	Hash       string    `json:"hash"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// exportManifest tracks the images copied into an export folder, so exporting again skips the
+// images already there and resumes an interrupted export. Entries are appended as images are
+// copied, so the manifest survives the export being cancelled or killed.
+type exportManifest struct {
+	root string
+	// previous holds the entries of earlier exports, current the images of this export, keyed by dest
+	previous map[string]manifestEntry
+	current  map[string]manifestEntry
+	file     *os.File
+	copied   int
+	skipped  int
+}
+
+// openManifest reads the manifest of the export folder at root, if any, and opens it to record
+// the images copied by a new export.
+func openManifest(root string) (*exportManifest, error) {
+	m := &exportManifest{
+		root:     root,
+		previous: make(map[string]manifestEntry),
+		current:  make(map[string]manifestEntry),
+	}
+
+	path := filepath.Join(root, manifestFile)
+	if err := m.read(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read export manifest: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open export manifest: %v", err)
+	}
+	m.file = f
+
+	return m, nil
+}
+
+// read loads the entries of the manifest at path, later entries replace earlier ones for the
+// same dest. A line cut short by an interrupted export is skipped, and so are entries pointing
+// outside of the export folder, which is never written to.
+func (m *exportManifest) read(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	//nolint:errcheck
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry manifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Printf("skipping invalid export manifest entry: %v", err)
+			continue
+		}
+		if !filepath.IsLocal(filepath.FromSlash(entry.Dest)) {
+			log.Printf("skipping export manifest entry outside of the export: %s", entry.Dest)
+			continue
+		}
+		m.previous[entry.Dest] = entry
+	}
+
+	return scanner.Err()
+}
+
+// exported reports whether source was already copied to dest by an earlier export, is unchanged
+// since and the copy still has the recorded contents, keeping it in this export if so.
+func (m *exportManifest) exported(source, dest string) bool {
+	entry, found := m.previous[dest]
+	if !found || entry.Source != source || entry.Hash == "" {
+		return false
+	}
+
+	info, err := os.Stat(source)
+	if err != nil || info.Size() != entry.Size || info.ModTime().UnixNano() != entry.ModTime {
+		return false
+	}
+
+	contents, err := os.ReadFile(filepath.Join(m.root, filepath.FromSlash(dest)))
+	if err != nil || data.HashContents(contents) != entry.Hash {
+		return false
+	}
+
+	m.current[dest] = entry
+	m.skipped++
+	return true
+}
+
+// occupied reports whether dest holds a file other than a copy of source, one copied by this
+// export or by another export sharing the folder, so it must not be written.
+func (m *exportManifest) occupied(dest, source string) bool {
+	if entry, found := m.current[dest]; found {
+		return entry.Source != source
+	}
+	if entry, found := m.previous[dest]; found && entry.Source == source {
+		return false
+	}
+
+	_, err := os.Stat(filepath.Join(m.root, filepath.FromSlash(dest)))
+	return err == nil
+}
+
+// record adds an image copied by this export to the manifest.
+func (m *exportManifest) record(entry manifestEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := m.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("could not record %s in the export manifest: %v", entry.Dest, err)
+	}
+
+	m.current[entry.Dest] = entry
+	m.copied++
+	return nil
+}
+
+// finish completes the export, rewriting the manifest with the images of this export and the
+// ones earlier exports copied, e.g. of another dataset sharing the export folder, which are left
+// untouched.
+func (m *exportManifest) finish() error {
+	entries := maps.Clone(m.previous)
+	maps.Copy(entries, m.current)
+
+	var content strings.Builder
+	for _, dest := range slices.Sorted(maps.Keys(entries)) {
+		line, err := json.Marshal(entries[dest])
+		if err != nil {
+			return err
+		}
+		content.Write(line)
+		content.WriteByte('\n')
+	}
+
+	if err := m.close(); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(m.root, manifestFile), []byte(content.String())); err != nil {
+		return fmt.Errorf("could not write export manifest: %v", err)
+	}
+
+	log.Printf("exported %d images, %d were already up to date", m.copied, m.skipped)
+	return nil
+}
+
+// close stops recording, the entries recorded so far let the next export resume from there.
+func (m *exportManifest) close() error {
+	if m.file == nil {
+		return nil
+	}
+
+	err := m.file.Close()
+	m.file = nil
+	return err
+}
@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"sync"
+)
+
+// cacheQueue hands out the images to cache to the workers. Images shown in the grid are
+// prioritized, the rest are cached in the background in dataset order.
+type cacheQueue struct {
+	mut      sync.Mutex
+	paths    []string
+	next     int
+	priority []string
+	// queued holds the images that were not handed out yet
+	queued  map[string]bool
+	stopped bool
+	workers sync.WaitGroup
+}
+
+func newCacheQueue(paths []string) *cacheQueue {
+	q := &cacheQueue{
+		paths:  paths,
+		queued: make(map[string]bool, len(paths)),
+	}
+	for _, path := range paths {
+		q.queued[path] = true
+	}
+
+	return q
+}
+
+// pop returns the next image to cache, and false once every image was handed out or the
+// queue was stopped.
+func (q *cacheQueue) pop() (string, bool) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	if q.stopped {
+		return "", false
+	}
+
+	for len(q.priority) > 0 {
+		path := q.priority[0]
+		q.priority = q.priority[1:]
+		if q.queued[path] {
+			delete(q.queued, path)
+			return path, true
+		}
+	}
+
+	for q.next < len(q.paths) {
+		path := q.paths[q.next]
+		q.next++
+		if q.queued[path] {
+			delete(q.queued, path)
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// prioritize caches paths first, in order. It replaces the previous priorities since only the
+// images currently shown matter.
+func (q *cacheQueue) prioritize(paths []string) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	q.priority = q.priority[:0]
+	for _, path := range paths {
+		if q.queued[path] {
+			q.priority = append(q.priority, path)
+		}
+	}
+}
+
+// drop removes paths from the images to cache, e.g. after they were deleted.
+func (q *cacheQueue) drop(paths []string) {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	for _, path := range paths {
+		delete(q.queued, path)
+	}
+}
+
+// stop makes the workers finish the image they are caching and waits for them.
+func (q *cacheQueue) stop() {
+	q.cancel()
+	q.workers.Wait()
+}
+
+// cancel stops handing out images without waiting for the workers.
+func (q *cacheQueue) cancel() {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	q.stopped = true
+}
+
+func (q *cacheQueue) isStopped() bool {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+	return q.stopped
+}
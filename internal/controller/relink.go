@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// ErrMostImagesMissing is returned when pruning would remove most images of the dataset, which
+// usually means its folder is not mounted rather than the images were deleted.
+var ErrMostImagesMissing = errors.New("most images of the dataset are missing, they were kept in the cache in case its folder is not mounted")
+
+// hashFiles returns the contents hash of each file, files that cannot be read are left out.
+func hashFiles(paths []string) map[string]string {
+	hashes := make(map[string]string)
+	mut := &sync.Mutex{}
+	jobs := make(chan string, len(paths))
+	for _, path := range paths {
+		jobs <- path
+	}
+	close(jobs)
+
+	wg := &sync.WaitGroup{}
+	for range runtime.NumCPU() {
+		wg.Go(func() {
+			for path := range jobs {
+				contents, err := os.ReadFile(path)
+				if err != nil {
+					log.Printf("could not open file %s: %v", path, err)
+					continue
+				}
+				hash := data.HashContents(contents)
+				mut.Lock()
+				hashes[path] = hash
+				mut.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	return hashes
+}
+
+// relinkImages finds the missing images that were renamed or moved, by matching their contents
+// with the added images, and moves their cache, bins and split pins to the new path. missing
+// holds the cached stats of the images no longer found and added the stats of the images not
+// cached yet. It returns the old path of each relinked image keyed by its new path.
+func (c *Controller) relinkImages(missing, added map[string]data.FileStat) (map[string]string, error) {
+	byHash := make(map[string][]string)
+	sizes := make(map[int64]bool)
+	for _, path := range slices.Sorted(maps.Keys(missing)) {
+		if hash := missing[path].Hash; hash != "" {
+			byHash[hash] = append(byHash[hash], path)
+			sizes[missing[path].Size] = true
+		}
+	}
+
+	// only the added images the size of a missing one can have the same contents, the others
+	// are not read, so loading a dataset doesn't wait on hashing every new image
+	var candidates []string
+	for path, stat := range added {
+		if sizes[stat.Size] {
+			candidates = append(candidates, path)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	hashes := hashFiles(candidates)
+	relinked := make(map[string]string)
+	renames := make(map[string]string)
+	for _, path := range slices.Sorted(maps.Keys(hashes)) {
+		candidates := byHash[hashes[path]]
+		if len(candidates) == 0 {
+			continue
+		}
+		byHash[hashes[path]] = candidates[1:]
+		relinked[path] = candidates[0]
+		renames[candidates[0]] = path
+	}
+	if len(renames) == 0 {
+		return nil, nil
+	}
+
+	log.Printf("relinking %d renamed or moved images", len(renames))
+	if err := c.db.RenameImages(renames); err != nil {
+		return nil, err
+	}
+	for oldPath, path := range renames {
+		c.forgetImages(oldPath, path)
+	}
+	for path := range relinked {
+		stat := added[path]
+		stat.Hash = hashes[path]
+		if err := c.db.SetImageStat(path, stat); err != nil {
+			log.Printf("could not update file stats of %s: %v", path, err)
+		}
+	}
+
+	return relinked, nil
+}
+
+// diffDataset returns the cached images missing from the dataset and the images of the
+// dataset that are not cached yet, with their stats.
+func diffDataset(d *data.Dataset, cached map[string]data.FileStat) (missing, added map[string]data.FileStat) {
+	missing = make(map[string]data.FileStat)
+	for path, stat := range cached {
+		if _, found := d.Stats[path]; !found {
+			missing[path] = stat
+		}
+	}
+
+	added = make(map[string]data.FileStat)
+	for path, stat := range d.Stats {
+		if _, found := cached[path]; !found {
+			added[path] = stat
+		}
+	}
+
+	return missing, added
+}
+
+// Relink repairs the database of the open dataset after its folder moved. Absolute paths left
+// over from older versions are rewritten relative to the dataset, from oldRoot or from a guess
+// when it is empty, and images renamed or moved inside the dataset are found again by their
+// contents. It returns how many images were repaired.
+func (c *Controller) Relink(oldRoot string) (int, error) {
+	if c.db == nil {
+		return 0, errNoDataset
+	}
+
+	rewritten, err := c.db.Relink(oldRoot)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := data.NewDataset(c.datasetRoot)
+	if err != nil {
+		return rewritten, err
+	}
+
+	cached, err := c.db.GetImageStats()
+	if err != nil {
+		return rewritten, err
+	}
+
+	relinked, err := c.relinkImages(diffDataset(d, cached))
+	if err != nil {
+		return rewritten, err
+	}
+
+	return rewritten + len(relinked), nil
+}
+
+// pruneImages relinks the cached images that were renamed or moved in the dataset d, and removes
+// the ones that no longer exist from the cache and their bins, along with the images that were
+// waiting to be cached. cached is updated with the relinked images, and the number of removed
+// images is returned. Unless force is set, nothing is removed when more than half of the images
+// are missing, ErrMostImagesMissing is returned instead.
+func (c *Controller) pruneImages(d *data.Dataset, cached map[string]data.FileStat, force bool) (int, error) {
+	missing, added := diffDataset(d, cached)
+	relinked, err := c.relinkImages(missing, added)
+	if err != nil {
+		return 0, err
+	}
+
+	pending, err := c.db.GetPendingImages()
+	if err != nil {
+		return 0, err
+	}
+	for path := range pending {
+		if _, found := d.Stats[path]; !found {
+			missing[path] = data.FileStat{}
+		}
+	}
+	for path, oldPath := range relinked {
+		delete(missing, oldPath)
+		delete(cached, oldPath)
+		cached[path] = d.Stats[path]
+	}
+
+	if !force && len(missing) > 0 && len(missing)*2 > len(cached)+len(pending) {
+		log.Printf("not removing %d of %d images no longer in the dataset", len(missing), len(cached)+len(pending))
+		return 0, ErrMostImagesMissing
+	}
+
+	if len(missing) > 0 {
+		log.Printf("removing %d images no longer in the dataset", len(missing))
+		if err := c.db.RemoveImages(slices.Collect(maps.Keys(missing))); err != nil {
+			return 0, err
+		}
+		for path := range missing {
+			delete(cached, path)
+			c.forgetImages(path)
+		}
+	}
+
+	return len(missing), nil
+}
@@ -0,0 +1,309 @@
+package controller
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/coolapso/picsort/internal/data"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// watchSettleDelay is how long a file must go without events before it is synced, so
+	// images that are still being written are not cached half way through.
+	watchSettleDelay = 500 * time.Millisecond
+	watchInterval    = 250 * time.Millisecond
+)
+
+type datasetWatcher struct {
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// WatchDataset watches the open dataset folder while it is open. New images are cached into
+// the To Sort bin, changed ones are cached again and deleted ones are dropped from their bins,
+// reloading only the bins they affect.
+func (c *Controller) WatchDataset() error {
+	if c.db == nil {
+		return errNoDataset
+	}
+	c.StopWatching()
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := addWatchDirs(watcher, c.datasetRoot); err != nil {
+		//nolint:errcheck
+		watcher.Close()
+		return err
+	}
+
+	w := &datasetWatcher{
+		watcher: watcher,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	c.mut.Lock()
+	c.watcher = w
+	c.mut.Unlock()
+	go c.watch(w)
+
+	return nil
+}
+
+// StopWatching stops watching the dataset folder, it does nothing if it is not being watched.
+func (c *Controller) StopWatching() {
+	c.mut.Lock()
+	w := c.watcher
+	c.watcher = nil
+	c.mut.Unlock()
+	if w == nil {
+		return
+	}
+
+	close(w.done)
+	<-w.stopped
+}
+
+// addWatchDirs watches root and all the folders below it, fsnotify does not watch recursively.
+func addWatchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+func (c *Controller) watch(w *datasetWatcher) {
+	defer close(w.stopped)
+	//nolint:errcheck
+	defer w.watcher.Close()
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	pending := make(map[string]time.Time)
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			for _, path := range c.watchedPaths(w.watcher, event) {
+				pending[path] = time.Now()
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("error watching dataset:", err)
+		case now := <-ticker.C:
+			var settled []string
+			for path, at := range pending {
+				if now.Sub(at) >= watchSettleDelay {
+					settled = append(settled, path)
+					delete(pending, path)
+				}
+			}
+			if len(settled) > 0 {
+				c.syncImages(settled)
+			}
+		}
+	}
+}
+
+// watchedPaths returns the images that may need syncing after event.
+func (c *Controller) watchedPaths(watcher *fsnotify.Watcher, event fsnotify.Event) []string {
+	if event.Op == fsnotify.Chmod {
+		return nil
+	}
+	if data.IsImage(event.Name) {
+		return []string{event.Name}
+	}
+
+	if event.Has(fsnotify.Create) {
+		info, err := os.Stat(event.Name)
+		if err != nil || !info.IsDir() {
+			return nil
+		}
+		// images can land in a new folder before it is watched
+		if err := addWatchDirs(watcher, event.Name); err != nil {
+			log.Printf("could not watch %s: %v", event.Name, err)
+		}
+		d, err := data.NewDataset(event.Name)
+		if err != nil {
+			log.Printf("could not scan %s: %v", event.Name, err)
+			return nil
+		}
+		return d.Images
+	}
+
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		// a folder moved away does not report events for the images it holds
+		c.dbMut.RLock()
+		defer c.dbMut.RUnlock()
+		if c.db == nil {
+			return nil
+		}
+		stats, err := c.db.GetImageStats()
+		if err != nil {
+			log.Println("could not get cached images:", err)
+			return nil
+		}
+		pending, err := c.db.GetPendingImages()
+		if err != nil {
+			log.Println("could not get images waiting to be cached:", err)
+			return nil
+		}
+		var paths []string
+		prefix := event.Name + string(filepath.Separator)
+		for _, path := range slices.Concat(slices.Collect(maps.Keys(stats)), slices.Collect(maps.Keys(pending))) {
+			if strings.HasPrefix(path, prefix) {
+				paths = append(paths, path)
+			}
+		}
+		return paths
+	}
+
+	return nil
+}
+
+// syncImages brings the cache in line with the given images after they changed on disk and
+// reloads the bins holding them. The database is read and changed while holding dbMut, so it is
+// not swapped meanwhile.
+func (c *Controller) syncImages(paths []string) {
+	removed, added, changed, cachedStats := c.diffImages(paths)
+
+	c.dbMut.Lock()
+	if c.db == nil {
+		c.dbMut.Unlock()
+		return
+	}
+	relinked, err := c.relinkImages(removed, added)
+	c.dbMut.Unlock()
+	if err != nil {
+		log.Println("could not relink renamed images:", err)
+	}
+	for path, oldPath := range relinked {
+		delete(removed, oldPath)
+		delete(added, path)
+	}
+
+	maps.Copy(changed, added)
+	var recached []string
+	for path, stat := range changed {
+		cached, found := cachedStats[path]
+		ok, err := c.cacheImage(path, stat, cached, found)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if ok {
+			recached = append(recached, path)
+		}
+	}
+
+	c.dbMut.Lock()
+	if c.db == nil {
+		c.dbMut.Unlock()
+		return
+	}
+	affected := slices.Concat(slices.Collect(maps.Keys(removed)), slices.Collect(maps.Keys(relinked)), recached)
+	bins, err := c.db.GetImageBins(affected)
+	if err != nil {
+		log.Println("could not get bins of changed images:", err)
+	}
+
+	if len(removed) > 0 {
+		if err := c.db.RemoveImages(slices.Collect(maps.Keys(removed))); err != nil {
+			log.Println("could not remove deleted images:", err)
+		}
+		for path := range removed {
+			c.forgetImages(path)
+		}
+	}
+	c.dbMut.Unlock()
+
+	// deleted images still waiting to be cached are not cached anymore
+	c.mut.Lock()
+	if c.queue != nil {
+		c.queue.drop(slices.Collect(maps.Keys(removed)))
+	}
+	c.mut.Unlock()
+
+	for _, id := range bins {
+		c.ui.ReloadBin(id)
+	}
+}
+
+// diffImages compares paths with the database, returning the stored images removed from disk,
+// the images not cached yet and the cached images that changed, along with the stats they were
+// cached with. Images still waiting to be cached are removed when deleted, their stats are empty.
+func (c *Controller) diffImages(paths []string) (removed, added, changed, cachedStats map[string]data.FileStat) {
+	removed = make(map[string]data.FileStat)
+	added = make(map[string]data.FileStat)
+	changed = make(map[string]data.FileStat)
+	cachedStats = make(map[string]data.FileStat)
+
+	c.dbMut.RLock()
+	defer c.dbMut.RUnlock()
+	if c.db == nil {
+		return removed, added, changed, cachedStats
+	}
+
+	for _, path := range paths {
+		cached, found, err := c.db.GetImageStat(path)
+		if err != nil {
+			log.Printf("could not get cached stats of %s: %v", path, err)
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				log.Printf("could not stat %s: %v", path, err)
+				continue
+			}
+			if found {
+				removed[path] = cached
+				continue
+			}
+			pending, err := c.db.IsPendingImage(path)
+			if err != nil {
+				log.Printf("could not check if %s is waiting to be cached: %v", path, err)
+			} else if pending {
+				removed[path] = data.FileStat{}
+			}
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+
+		stat := data.FileStat{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		switch {
+		case !found:
+			added[path] = stat
+		case !cached.SameFile(stat):
+			changed[path] = stat
+			cachedStats[path] = cached
+		}
+	}
+
+	return removed, added, changed, cachedStats
+}
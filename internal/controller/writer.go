@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/coolapso/picsort/internal/data"
+	"github.com/coolapso/picsort/internal/database"
+)
+
+const (
+	// cacheBatchSize is the number of images stored per transaction, it is also how many images
+	// the workers can get ahead of the writer before they wait for it.
+	cacheBatchSize = 64
+	// cacheFlushInterval stores partial batches, so prioritized images don't wait for a full batch
+	// to show up.
+	cacheFlushInterval = 250 * time.Millisecond
+)
+
+// cacheResult is an image cached by a worker, waiting to be stored by the writer.
+type cacheResult struct {
+	path string
+	// image is nil when the contents did not change and only the stats need updating
+	image *database.EncodedImage
+	stat  data.FileStat
+	err   error
+}
+
+// cacheBatch collects the results stored in a single transaction.
+type cacheBatch struct {
+	images []database.EncodedImage
+	stats  map[string]data.FileStat
+	paths  []string
+}
+
+func (b *cacheBatch) add(r cacheResult) {
+	b.paths = append(b.paths, r.path)
+	if r.image != nil {
+		b.images = append(b.images, *r.image)
+		return
+	}
+
+	if b.stats == nil {
+		b.stats = make(map[string]data.FileStat)
+	}
+	b.stats[r.path] = r.stat
+}
+
+func (b *cacheBatch) reset() {
+	b.images = b.images[:0]
+	b.stats = nil
+	b.paths = b.paths[:0]
+}
+
+// cacheWriter stores the results of the workers from a single goroutine, in batches, so the workers
+// never wait on each other for the database.
+type cacheWriter struct {
+	c         *Controller
+	q         *cacheQueue
+	results   chan cacheResult
+	total     int
+	processed int
+	// failed counts the images that could not be cached, err is the first of their errors.
+	failed int
+	err    error
+	// writeErr is set when the database could not be written, caching is stopped then.
+	writeErr error
+}
+
+func newCacheWriter(c *Controller, q *cacheQueue, total int) *cacheWriter {
+	return &cacheWriter{
+		c:       c,
+		q:       q,
+		results: make(chan cacheResult, cacheBatchSize),
+		total:   total,
+	}
+}
+
+// run stores the results until the results channel is closed, flushing a batch when it is full
+// or every cacheFlushInterval.
+func (w *cacheWriter) run() {
+	ticker := time.NewTicker(cacheFlushInterval)
+	defer ticker.Stop()
+
+	batch := &cacheBatch{}
+	for {
+		select {
+		case r, ok := <-w.results:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			if r.err != nil {
+				log.Println(r.err)
+				if w.failed == 0 {
+					w.err = r.err
+				}
+				w.failed++
+				w.processed++
+				continue
+			}
+
+			batch.add(r)
+			if len(batch.paths) >= cacheBatchSize {
+				w.flush(batch)
+			}
+		case <-ticker.C:
+			w.flush(batch)
+		}
+	}
+}
+
+// flush stores batch and reports the progress. Once the database fails to be written caching is
+// stopped, and the images still being cached are dropped.
+func (w *cacheWriter) flush(batch *cacheBatch) {
+	if len(batch.paths) == 0 {
+		return
+	}
+	defer batch.reset()
+
+	if w.writeErr == nil {
+		w.writeErr = w.store(batch)
+		if w.writeErr != nil {
+			w.q.cancel()
+		}
+	}
+	if w.writeErr != nil {
+		return
+	}
+
+	w.c.forgetImages(batch.paths...)
+	w.processed += len(batch.paths)
+	w.c.ui.SetCacheProgress(float64(w.processed)/float64(w.total), filepath.Base(batch.paths[len(batch.paths)-1]))
+}
+
+func (w *cacheWriter) store(batch *cacheBatch) error {
+	if len(batch.images) > 0 {
+		if err := w.c.db.SetImages(batch.images); err != nil {
+			return err
+		}
+	}
+	if len(batch.stats) > 0 {
+		return w.c.db.SetImageStats(batch.stats)
+	}
+
+	return nil
+}
+
+// failure returns what went wrong while caching, if anything.
+func (w *cacheWriter) failure() error {
+	if w.writeErr != nil {
+		return fmt.Errorf("could not store cached images, caching stopped: %w", w.writeErr)
+	}
+	if w.failed == 1 {
+		return w.err
+	}
+	if w.failed > 1 {
+		return fmt.Errorf("could not cache %d images, the first failed with: %w", w.failed, w.err)
+	}
+
+	return nil
+}
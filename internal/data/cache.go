@@ -0,0 +1,143 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nfnt/resize"
+)
+
+// ResizeFilter is the resampling filter used to scale images down to thumbnails and previews.
+type ResizeFilter string
+
+const (
+	FilterNearest  ResizeFilter = "nearest"
+	FilterBilinear ResizeFilter = "bilinear"
+	FilterBicubic  ResizeFilter = "bicubic"
+	FilterMitchell ResizeFilter = "mitchell"
+	FilterLanczos2 ResizeFilter = "lanczos2"
+	FilterLanczos3 ResizeFilter = "lanczos3"
+)
+
+// ResizeFilters lists the filters from the fastest to the sharpest.
+var ResizeFilters = []ResizeFilter{FilterNearest, FilterBilinear, FilterBicubic, FilterMitchell, FilterLanczos2, FilterLanczos3}
+
+const (
+	minCacheSize = 32
+	maxCacheSize = 8192
+)
+
+var (
+	errInvalidCacheSize = fmt.Errorf("thumbnail and preview sizes must be between %d and %d pixels", minCacheSize, maxCacheSize)
+	errInvalidFilter    = errors.New("unknown resize filter")
+	errInvalidQuality   = errors.New("JPEG quality must be between 1 and 100")
+)
+
+// CacheConfig describes how the thumbnails and previews of a dataset are generated. Images are
+// scaled down to fit in the sizes keeping their aspect ratio, and never scaled up.
+type CacheConfig struct {
+	ThumbnailSize uint         `json:"thumbnail_size"`
+	PreviewWidth  uint         `json:"preview_width"`
+	PreviewHeight uint         `json:"preview_height"`
+	Filter        ResizeFilter `json:"filter"`
+	Quality       int          `json:"quality"`
+}
+
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		ThumbnailSize: 200,
+		PreviewWidth:  800,
+		PreviewHeight: 600,
+		Filter:        FilterLanczos3,
+		Quality:       jpeg.DefaultQuality,
+	}
+}
+
+func (c CacheConfig) Validate() error {
+	for _, size := range []uint{c.ThumbnailSize, c.PreviewWidth, c.PreviewHeight} {
+		if size < minCacheSize || size > maxCacheSize {
+			return errInvalidCacheSize
+		}
+	}
+	if !slices.Contains(ResizeFilters, c.Filter) {
+		return errInvalidFilter
+	}
+	if c.Quality < 1 || c.Quality > 100 {
+		return errInvalidQuality
+	}
+
+	return nil
+}
+
+// Interpolation returns the resize function of the config filter.
+func (c CacheConfig) Interpolation() resize.InterpolationFunction {
+	switch c.Filter {
+	case FilterNearest:
+		return resize.NearestNeighbor
+	case FilterBilinear:
+		return resize.Bilinear
+	case FilterBicubic:
+		return resize.Bicubic
+	case FilterMitchell:
+		return resize.MitchellNetravali
+	case FilterLanczos2:
+		return resize.Lanczos2
+	default:
+		return resize.Lanczos3
+	}
+}
+
+func (c CacheConfig) String() string {
+	return fmt.Sprintf("thumbnails %dx%d, previews %dx%d, %s, quality %d",
+		c.ThumbnailSize, c.ThumbnailSize, c.PreviewWidth, c.PreviewHeight, c.Filter, c.Quality)
+}
+
+// CacheStats describes how much space the cache of a dataset takes. Pending is the number of
+// images waiting to be cached, Thumbnails and Previews are the size of the cached images and
+// File the size of the database files on disk.
+type CacheStats struct {
+	Images     int
+	Pending    int
+	Thumbnails int64
+	Previews   int64
+	File       int64
+}
+
+// FormatSize returns size in bytes in a human readable form, e.g. 1.5 MiB.
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// ParseSize parses a size in the form <width>x<height>, e.g. 1920x1080.
+func ParseSize(str string) (width, height uint, err error) {
+	w, h, found := strings.Cut(str, "x")
+	if !found {
+		return 0, 0, fmt.Errorf("expected a size like 1920x1080, got %q", str)
+	}
+
+	wv, err := strconv.ParseUint(strings.TrimSpace(w), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid width %q: %v", w, err)
+	}
+	hv, err := strconv.ParseUint(strings.TrimSpace(h), 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid height %q: %v", h, err)
+	}
+
+	return uint(wv), uint(hv), nil
+}
@@ -1,6 +1,8 @@
 package data
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"io/fs"
 	"path/filepath"
 	"strings"
@@ -14,21 +16,39 @@ var imageExtensions = map[string]bool{
 	".webp": true,
 }
 
+// FileStat is what is known about an image file to tell whether it changed since it was cached.
+// ModTime is in unix nanoseconds, Hash is the hex encoded sha256 of the file contents.
+type FileStat struct {
+	Size    int64
+	ModTime int64
+	Hash    string
+}
+
+// SameFile reports whether s and o describe the same file without looking at its contents.
+func (s FileStat) SameFile(o FileStat) bool {
+	return s.Size == o.Size && s.ModTime == o.ModTime
+}
+
 type Dataset struct {
 	Path   string
 	Images []string
+	Stats  map[string]FileStat
 }
 
 func NewDataset(path string) (*Dataset, error) {
-	d := &Dataset{Path: path}
+	d := &Dataset{Path: path, Stats: make(map[string]FileStat)}
 	err := filepath.WalkDir(path, func(s string, de fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if !de.IsDir() {
-			ext := strings.ToLower(filepath.Ext(s))
-			if imageExtensions[ext] {
+			if IsImage(s) {
+				info, err := de.Info()
+				if err != nil {
+					return err
+				}
 				d.Images = append(d.Images, s)
+				d.Stats[s] = FileStat{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
 			}
 		}
 		return nil
@@ -40,3 +60,14 @@ func NewDataset(path string) (*Dataset, error) {
 
 	return d, nil
 }
+
+// IsImage reports whether path has the extension of an image picsort can sort.
+func IsImage(path string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// HashContents returns the hex encoded sha256 of an image file contents.
+func HashContents(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
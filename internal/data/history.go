@@ -0,0 +1,40 @@
+package data
+
+import "time"
+
+// NoBin is used in a BinChange for the side of the change where the image was in no bin.
+const NoBin = -2
+
+const (
+	HistoryMove      = "move"
+	HistoryAdd       = "add"
+	HistoryRemoveBin = "remove_bin"
+	HistoryExclude   = "exclude"
+)
+
+// BinChange is a change to the bins an image is in. From is NoBin when the image was
+// added to To, and To is NoBin when the image was removed from From.
+type BinChange struct {
+	Path string `json:"path"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+// Reverse returns the change that undoes c.
+func (c BinChange) Reverse() BinChange {
+	return BinChange{Path: c.Path, From: c.To, To: c.From}
+}
+
+// HistoryEntry is a sorting operation that can be undone and redone. SourceID and DestID
+// are the bins images were taken from and sent to, BinName is the name of the removed
+// bin for HistoryRemoveBin entries.
+type HistoryEntry struct {
+	ID       int64
+	Action   string
+	SourceID int
+	DestID   int
+	BinName  string
+	Changes  []BinChange
+	Undone   bool
+	Time     time.Time
+}
@@ -0,0 +1,248 @@
+package data
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"math"
+	"math/bits"
+	"slices"
+
+	"github.com/nfnt/resize"
+)
+
+// HashAlgorithm selects the perceptual hash used to tell whether two images look alike.
+type HashAlgorithm string
+
+const (
+	// HashAverage sets a bit for every pixel of an 8x8 thumbnail brighter than the mean.
+	HashAverage HashAlgorithm = "average"
+	// HashDifference sets a bit for every pixel of a 9x8 thumbnail brighter than its right neighbour.
+	HashDifference HashAlgorithm = "difference"
+	// HashPerceptual sets a bit for every low frequency of a 32x32 thumbnail above the median,
+	// it is the most robust to brightness and compression changes.
+	HashPerceptual HashAlgorithm = "perceptual"
+)
+
+const maxHashDistance = 64
+
+var (
+	errInvalidAlgorithm = errors.New("hash algorithm must be average, difference or perceptual")
+	errInvalidThreshold = errors.New("similarity threshold must be between 0 and 64 bits")
+)
+
+// PerceptualHashes holds the perceptual hashes of an image, images that look alike have hashes
+// that differ in few bits.
+type PerceptualHashes struct {
+	Average    uint64
+	Difference uint64
+	Perceptual uint64
+}
+
+// NewPerceptualHashes computes the perceptual hashes of img.
+func NewPerceptualHashes(img image.Image) PerceptualHashes {
+	return PerceptualHashes{
+		Average:    averageHash(img),
+		Difference: differenceHash(img),
+		Perceptual: perceptualHash(img),
+	}
+}
+
+// Get returns the hash computed with the given algorithm.
+func (h PerceptualHashes) Get(algorithm HashAlgorithm) uint64 {
+	switch algorithm {
+	case HashAverage:
+		return h.Average
+	case HashDifference:
+		return h.Difference
+	default:
+		return h.Perceptual
+	}
+}
+
+// HashDistance returns the number of bits two hashes differ in.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// grayscale scales img down to width x height and returns the luminance of its pixels, row by row.
+func grayscale(img image.Image, width, height int) []float64 {
+	small := resize.Resize(uint(width), uint(height), img, resize.Bilinear)
+	bounds := small.Bounds()
+	pixels := make([]float64, 0, width*height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray := color.GrayModel.Convert(small.At(x, y)).(color.Gray)
+			pixels = append(pixels, float64(gray.Y))
+		}
+	}
+
+	return pixels
+}
+
+func averageHash(img image.Image) uint64 {
+	pixels := grayscale(img, 8, 8)
+	mean := 0.0
+	for _, p := range pixels {
+		mean += p
+	}
+	mean /= float64(len(pixels))
+
+	var hash uint64
+	for i, p := range pixels {
+		if p > mean {
+			hash |= 1 << uint(i)
+		}
+	}
+
+	return hash
+}
+
+func differenceHash(img image.Image) uint64 {
+	pixels := grayscale(img, 9, 8)
+	var hash uint64
+	bit := 0
+	for y := range 8 {
+		for x := range 8 {
+			if pixels[y*9+x] > pixels[y*9+x+1] {
+				hash |= 1 << uint(bit)
+			}
+			bit++
+		}
+	}
+
+	return hash
+}
+
+// dctCosines holds cos((2x+1)uπ/64) of the 32 point DCT-II, indexed by u*32+x.
+var dctCosines = func() []float64 {
+	cosines := make([]float64, 32*32)
+	for u := range 32 {
+		for x := range 32 {
+			cosines[u*32+x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / 64)
+		}
+	}
+	return cosines
+}()
+
+func perceptualHash(img image.Image) uint64 {
+	pixels := grayscale(img, 32, 32)
+
+	// the DCT is separable, transform the rows and then the columns of the 8 lowest frequencies
+	rows := make([]float64, 32*8)
+	for y := range 32 {
+		for u := range 8 {
+			sum := 0.0
+			for x := range 32 {
+				sum += pixels[y*32+x] * dctCosines[u*32+x]
+			}
+			rows[y*8+u] = sum
+		}
+	}
+
+	coefficients := make([]float64, 0, 64)
+	for v := range 8 {
+		for u := range 8 {
+			sum := 0.0
+			for y := range 32 {
+				sum += rows[y*8+u] * dctCosines[v*32+y]
+			}
+			coefficients = append(coefficients, sum)
+		}
+	}
+
+	// the DC coefficient is left out of the median, it only carries the overall brightness
+	sorted := slices.Clone(coefficients[1:])
+	slices.Sort(sorted)
+	median := (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+
+	var hash uint64
+	for i, c := range coefficients {
+		if c > median {
+			hash |= 1 << uint(i)
+		}
+	}
+
+	return hash
+}
+
+// ClusterConfig describes how near-duplicate images are grouped: images whose hashes differ in
+// at most Threshold bits are near-duplicates, and so are the near-duplicates of near-duplicates.
+type ClusterConfig struct {
+	Algorithm HashAlgorithm `json:"algorithm"`
+	Threshold int           `json:"threshold"`
+}
+
+func DefaultClusterConfig() ClusterConfig {
+	return ClusterConfig{
+		Algorithm: HashPerceptual,
+		Threshold: 8,
+	}
+}
+
+func (c ClusterConfig) Validate() error {
+	if c.Algorithm != HashAverage && c.Algorithm != HashDifference && c.Algorithm != HashPerceptual {
+		return errInvalidAlgorithm
+	}
+	if c.Threshold < 0 || c.Threshold > maxHashDistance {
+		return errInvalidThreshold
+	}
+
+	return nil
+}
+
+// Cluster groups the images into clusters of near-duplicates. Only clusters of two or more
+// images are returned, each sorted by path and ordered by their first path.
+func (c ClusterConfig) Cluster(hashes map[string]PerceptualHashes) [][]string {
+	paths := make([]string, 0, len(hashes))
+	for path := range hashes {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	values := make([]uint64, len(paths))
+	for i, path := range paths {
+		values[i] = hashes[path].Get(c.Algorithm)
+	}
+
+	parents := make([]int, len(paths))
+	for i := range parents {
+		parents[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parents[i] != i {
+			parents[i] = find(parents[i])
+		}
+		return parents[i]
+	}
+
+	for i := range values {
+		for j := i + 1; j < len(values); j++ {
+			if HashDistance(values[i], values[j]) <= c.Threshold {
+				if a, b := find(i), find(j); a != b {
+					parents[max(a, b)] = min(a, b)
+				}
+			}
+		}
+	}
+
+	members := make(map[int][]string)
+	var roots []int
+	for i, path := range paths {
+		root := find(i)
+		if _, found := members[root]; !found {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], path)
+	}
+
+	var clusters [][]string
+	for _, root := range roots {
+		if len(members[root]) > 1 {
+			clusters = append(clusters, members[root])
+		}
+	}
+
+	return clusters
+}
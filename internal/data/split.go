@@ -0,0 +1,303 @@
+package data
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// RemainderPolicy decides where the images left over by rounding the split ratios go,
+// so that no image is ever dropped from an export.
+type RemainderPolicy string
+
+const (
+	// RemainderDistribute hands the leftovers to the splits with the largest fractional part,
+	// splits with equal ratios always get equal counts.
+	RemainderDistribute RemainderPolicy = "distribute"
+	// RemainderTrain hands all leftovers to the training split.
+	RemainderTrain RemainderPolicy = "train"
+)
+
+const (
+	SplitTraining   = "training"
+	SplitValidation = "validation"
+	SplitTest       = "test"
+)
+
+var (
+	errInvalidRatios    = errors.New("split ratios must not be negative and the training ratio must be greater than 0")
+	errInvalidFolds     = errors.New("number of folds must be 0 or at least 2")
+	errInvalidRemainder = errors.New("remainder policy must be either distribute or train")
+)
+
+// SplitConfig describes how the images of each bin are split when exporting.
+// Ratios are relative to each other, so 0.6/0.2/0.2 and 60/20/20 are the same split.
+// When Folds is greater than 1 the test ratio is held out and the rest of the images
+// are split into Folds equally sized folds, the validation ratio is ignored.
+type SplitConfig struct {
+	Train      float64         `json:"train"`
+	Validation float64         `json:"validation"`
+	Test       float64         `json:"test"`
+	Folds      int             `json:"folds"`
+	Remainder  RemainderPolicy `json:"remainder"`
+}
+
+func DefaultSplitConfig() SplitConfig {
+	return SplitConfig{
+		Train:      0.6,
+		Validation: 0.2,
+		Test:       0.2,
+		Remainder:  RemainderDistribute,
+	}
+}
+
+func (s SplitConfig) Validate() error {
+	if s.Train <= 0 || s.Validation < 0 || s.Test < 0 {
+		return errInvalidRatios
+	}
+	if s.Folds < 0 || s.Folds == 1 {
+		return errInvalidFolds
+	}
+	if s.Remainder != RemainderDistribute && s.Remainder != RemainderTrain {
+		return errInvalidRemainder
+	}
+
+	return nil
+}
+
+// Splits returns the names of the splits produced by the config, in export order.
+func (s SplitConfig) Splits() []string {
+	var names []string
+	if s.Folds > 1 {
+		for i := range s.Folds {
+			names = append(names, fmt.Sprintf("fold_%d", i+1))
+		}
+	} else {
+		names = append(names, SplitTraining)
+		if s.Validation > 0 {
+			names = append(names, SplitValidation)
+		}
+	}
+
+	if s.Test > 0 {
+		names = append(names, SplitTest)
+	}
+
+	return names
+}
+
+// Counts returns how many of n images go into each split, the counts always add up to n.
+func (s SplitConfig) Counts(n int) map[string]int {
+	counts := make(map[string]int)
+	if s.Folds > 1 {
+		total := s.Train + s.Validation + s.Test
+		held := s.apportion(n, []float64{(s.Train + s.Validation) / total, s.Test / total})
+		// folds are always kept as even as possible, whatever the remainder policy
+		for i := range s.Folds {
+			counts[fmt.Sprintf("fold_%d", i+1)] = held[0] / s.Folds
+			if i < held[0]%s.Folds {
+				counts[fmt.Sprintf("fold_%d", i+1)]++
+			}
+		}
+		if s.Test > 0 {
+			counts[SplitTest] = held[1]
+		}
+		return counts
+	}
+
+	total := s.Train + s.Validation + s.Test
+	shares := s.apportion(n, []float64{s.Train / total, s.Validation / total, s.Test / total})
+	counts[SplitTraining] = shares[0]
+	if s.Validation > 0 {
+		counts[SplitValidation] = shares[1]
+	}
+	if s.Test > 0 {
+		counts[SplitTest] = shares[2]
+	}
+
+	return counts
+}
+
+// apportion splits n into len(shares) integer parts following the remainder policy,
+// the first share is considered the training share.
+func (s SplitConfig) apportion(n int, shares []float64) []int {
+	counts := make([]int, len(shares))
+	assigned := 0
+	for i, share := range shares {
+		counts[i] = int(math.Floor(share * float64(n)))
+		assigned += counts[i]
+	}
+
+	leftover := n - assigned
+	if s.Remainder == RemainderTrain {
+		counts[0] += leftover
+		return counts
+	}
+
+	// leftovers go to the shares with the largest fractional part first. Equal shares are served
+	// together so that equal ratios always get equal counts, when there are not enough leftovers
+	// for all of them they are skipped and whatever is left goes to training.
+	var order []int
+	for i, share := range shares {
+		if share > 0 {
+			order = append(order, i)
+		}
+	}
+	fraction := func(i int) float64 {
+		return shares[i]*float64(n) - float64(counts[i])
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		if c := cmp.Compare(fraction(b), fraction(a)); c != 0 {
+			return c
+		}
+		return cmp.Compare(shares[b], shares[a])
+	})
+	for start := 0; start < len(order) && leftover > 0; {
+		end := start + 1
+		for end < len(order) && shares[order[end]] == shares[order[start]] {
+			end++
+		}
+		if end-start <= leftover {
+			for _, i := range order[start:end] {
+				counts[i]++
+			}
+			leftover -= end - start
+		}
+		start = end
+	}
+	counts[0] += leftover
+
+	return counts
+}
+
+// Split partitions paths into the config splits, keeping the order of paths.
+func (s SplitConfig) Split(paths []string) map[string][]string {
+	return s.SplitPinned(paths, nil)
+}
+
+// SplitPinned partitions paths into the config splits like Split, but images pinned
+// to one of the config splits always land in it. The remaining images fill what is left
+// of each split in order, if pins overflow a split the others shrink to keep the total.
+func (s SplitConfig) SplitPinned(paths []string, pins map[string]string) map[string][]string {
+	counts := s.Counts(len(paths))
+	names := s.Splits()
+	splits := make(map[string][]string)
+
+	var unpinned []string
+	for _, path := range paths {
+		if split, ok := pins[path]; ok && slices.Contains(names, split) {
+			splits[split] = append(splits[split], path)
+			continue
+		}
+		unpinned = append(unpinned, path)
+	}
+
+	for _, name := range names {
+		free := max(0, counts[name]-len(splits[name]))
+		free = min(free, len(unpinned))
+		splits[name] = append(splits[name], unpinned[:free]...)
+		unpinned = unpinned[free:]
+	}
+	splits[names[0]] = append(splits[names[0]], unpinned...)
+
+	return splits
+}
+
+// SplitClustered partitions paths into the config splits like SplitPinned, but images of the
+// same cluster always land in the same split. clusters maps paths to a cluster id, images without
+// one are a cluster of their own. Clusters holding a pinned image go to its split, the others go
+// in order to the split that is furthest below its share.
+func (s SplitConfig) SplitClustered(paths []string, clusters map[string]int, pins map[string]string) map[string][]string {
+	counts := s.Counts(len(paths))
+	names := s.Splits()
+
+	var groups [][]string
+	index := make(map[int]int)
+	for _, path := range paths {
+		id, clustered := clusters[path]
+		if !clustered {
+			groups = append(groups, []string{path})
+			continue
+		}
+		if i, found := index[id]; found {
+			groups[i] = append(groups[i], path)
+			continue
+		}
+		index[id] = len(groups)
+		groups = append(groups, []string{path})
+	}
+
+	splits := make(map[string][]string)
+	var unpinned [][]string
+	for _, group := range groups {
+		pinned := ""
+		for _, path := range group {
+			if split, ok := pins[path]; ok && slices.Contains(names, split) {
+				pinned = split
+				break
+			}
+		}
+		if pinned == "" {
+			unpinned = append(unpinned, group)
+			continue
+		}
+		splits[pinned] = append(splits[pinned], group...)
+	}
+
+	for _, group := range unpinned {
+		best := names[0]
+		for _, name := range names[1:] {
+			if counts[name]-len(splits[name]) > counts[best]-len(splits[best]) {
+				best = name
+			}
+		}
+		splits[best] = append(splits[best], group...)
+	}
+
+	return splits
+}
+
+func (s SplitConfig) String() string {
+	total := s.Train + s.Validation + s.Test
+	percent := func(r float64) string {
+		return strconv.FormatFloat(math.Round(r/total*1000)/10, 'f', -1, 64) + "%"
+	}
+
+	var parts []string
+	if s.Folds > 1 {
+		parts = append(parts, fmt.Sprintf("%d folds %s", s.Folds, percent(s.Train+s.Validation)))
+	} else {
+		parts = append(parts, "training "+percent(s.Train))
+		if s.Validation > 0 {
+			parts = append(parts, "validation "+percent(s.Validation))
+		}
+	}
+	if s.Test > 0 {
+		parts = append(parts, "test "+percent(s.Test))
+	}
+
+	return strings.Join(parts, " / ")
+}
+
+// ParseRatios parses a comma separated list of two or three ratios, training,
+// validation and an optional test ratio, e.g. "0.7,0.15,0.15" or "80,20".
+func ParseRatios(str string) (train, validation, test float64, err error) {
+	fields := strings.Split(str, ",")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, 0, 0, fmt.Errorf("expected 2 or 3 comma separated ratios, got %q", str)
+	}
+
+	ratios := make([]float64, 3)
+	for i, field := range fields {
+		ratios[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid ratio %q: %v", field, err)
+		}
+	}
+
+	return ratios[0], ratios[1], ratios[2], nil
+}
@@ -0,0 +1,226 @@
+package data
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestCounts(t *testing.T) {
+	tests := []struct {
+		name  string
+		split SplitConfig
+		n     int
+		want  map[string]int
+	}{
+		{
+			name:  "rounding leftover goes to training",
+			split: SplitConfig{Train: 0.7, Validation: 0.15, Test: 0.15, Remainder: RemainderDistribute},
+			n:     9,
+			want:  map[string]int{SplitTraining: 7, SplitValidation: 1, SplitTest: 1},
+		},
+		{
+			name:  "percentages are the same split",
+			split: SplitConfig{Train: 70, Validation: 15, Test: 15, Remainder: RemainderDistribute},
+			n:     9,
+			want:  map[string]int{SplitTraining: 7, SplitValidation: 1, SplitTest: 1},
+		},
+		{
+			name:  "distribute serves equal ratios together",
+			split: SplitConfig{Train: 0.6, Validation: 0.2, Test: 0.2, Remainder: RemainderDistribute},
+			n:     9,
+			want:  map[string]int{SplitTraining: 5, SplitValidation: 2, SplitTest: 2},
+		},
+		{
+			name:  "train keeps every leftover",
+			split: SplitConfig{Train: 0.6, Validation: 0.2, Test: 0.2, Remainder: RemainderTrain},
+			n:     9,
+			want:  map[string]int{SplitTraining: 7, SplitValidation: 1, SplitTest: 1},
+		},
+		{
+			name:  "distribute by largest fractional part",
+			split: SplitConfig{Train: 0.5, Validation: 0.3, Test: 0.2, Remainder: RemainderDistribute},
+			n:     9,
+			want:  map[string]int{SplitTraining: 4, SplitValidation: 3, SplitTest: 2},
+		},
+		{
+			name:  "train ignores fractional parts",
+			split: SplitConfig{Train: 0.5, Validation: 0.3, Test: 0.2, Remainder: RemainderTrain},
+			n:     9,
+			want:  map[string]int{SplitTraining: 6, SplitValidation: 2, SplitTest: 1},
+		},
+		{
+			name:  "equal ratios with too few leftovers",
+			split: SplitConfig{Train: 1, Validation: 1, Test: 1, Remainder: RemainderDistribute},
+			n:     11,
+			want:  map[string]int{SplitTraining: 5, SplitValidation: 3, SplitTest: 3},
+		},
+		{
+			name:  "two-way split",
+			split: SplitConfig{Train: 80, Validation: 20, Remainder: RemainderDistribute},
+			n:     7,
+			want:  map[string]int{SplitTraining: 6, SplitValidation: 1},
+		},
+		{
+			name:  "single image",
+			split: SplitConfig{Train: 0.7, Validation: 0.15, Test: 0.15, Remainder: RemainderDistribute},
+			n:     1,
+			want:  map[string]int{SplitTraining: 1, SplitValidation: 0, SplitTest: 0},
+		},
+		{
+			name:  "no images",
+			split: SplitConfig{Train: 0.7, Validation: 0.15, Test: 0.15, Remainder: RemainderDistribute},
+			n:     0,
+			want:  map[string]int{SplitTraining: 0, SplitValidation: 0, SplitTest: 0},
+		},
+		{
+			name:  "folds with a held out test split",
+			split: SplitConfig{Train: 0.8, Test: 0.2, Folds: 3, Remainder: RemainderDistribute},
+			n:     11,
+			want:  map[string]int{"fold_1": 3, "fold_2": 3, "fold_3": 3, SplitTest: 2},
+		},
+		{
+			name:  "folds ignore the remainder policy",
+			split: SplitConfig{Train: 0.8, Test: 0.2, Folds: 3, Remainder: RemainderTrain},
+			n:     10,
+			want:  map[string]int{"fold_1": 3, "fold_2": 3, "fold_3": 2, SplitTest: 2},
+		},
+		{
+			name:  "folds ignore the validation ratio",
+			split: SplitConfig{Train: 0.6, Validation: 0.4, Folds: 4, Remainder: RemainderDistribute},
+			n:     10,
+			want:  map[string]int{"fold_1": 3, "fold_2": 3, "fold_3": 2, "fold_4": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.split.Counts(tt.n)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("Counts(%d) = %v, want %v", tt.n, got, tt.want)
+			}
+			total := 0
+			for _, count := range got {
+				total += count
+			}
+			if total != tt.n {
+				t.Errorf("Counts(%d) adds up to %d", tt.n, total)
+			}
+		})
+	}
+}
+
+func TestApportion(t *testing.T) {
+	tests := []struct {
+		name      string
+		remainder RemainderPolicy
+		n         int
+		shares    []float64
+		want      []int
+	}{
+		{"exact", RemainderDistribute, 10, []float64{0.6, 0.2, 0.2}, []int{6, 2, 2}},
+		{"empty shares never get leftovers", RemainderDistribute, 3, []float64{0.5, 0, 0.5}, []int{2, 0, 1}},
+		{"largest fraction first", RemainderDistribute, 7, []float64{0.4, 0.6}, []int{3, 4}},
+		{"train", RemainderTrain, 7, []float64{0.4, 0.6}, []int{3, 4}},
+		{"equal shares together", RemainderDistribute, 10, []float64{0.25, 0.375, 0.375}, []int{2, 4, 4}},
+		{"train takes the leftovers", RemainderTrain, 10, []float64{0.25, 0.375, 0.375}, []int{4, 3, 3}},
+		{"no images", RemainderDistribute, 0, []float64{0.5, 0.5}, []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := SplitConfig{Remainder: tt.remainder}
+			if got := s.apportion(tt.n, tt.shares); !slices.Equal(got, tt.want) {
+				t.Errorf("apportion(%d, %v) = %v, want %v", tt.n, tt.shares, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPinned(t *testing.T) {
+	paths := []string{"a", "b", "c", "d", "e"}
+	split := SplitConfig{Train: 0.6, Validation: 0.2, Test: 0.2, Remainder: RemainderDistribute}
+	tests := []struct {
+		name  string
+		split SplitConfig
+		pins  map[string]string
+		want  map[string][]string
+	}{
+		{
+			name:  "no pins keeps the order",
+			split: split,
+			want:  map[string][]string{SplitTraining: {"a", "b", "c"}, SplitValidation: {"d"}, SplitTest: {"e"}},
+		},
+		{
+			name:  "pinned images fill their split first",
+			split: split,
+			pins:  map[string]string{"e": SplitTraining},
+			want:  map[string][]string{SplitTraining: {"e", "a", "b"}, SplitValidation: {"c"}, SplitTest: {"d"}},
+		},
+		{
+			name:  "overflowing pins shrink the other splits",
+			split: split,
+			pins:  map[string]string{"a": SplitTest, "b": SplitTest},
+			want:  map[string][]string{SplitTraining: {"c", "d", "e"}, SplitTest: {"a", "b"}},
+		},
+		{
+			name:  "pins to splits not exported are ignored",
+			split: SplitConfig{Train: 0.8, Test: 0.2, Remainder: RemainderDistribute},
+			pins:  map[string]string{"a": SplitValidation},
+			want:  map[string][]string{SplitTraining: {"a", "b", "c", "d"}, SplitTest: {"e"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.split.SplitPinned(paths, tt.pins)
+			total := 0
+			for _, name := range tt.split.Splits() {
+				if !slices.Equal(got[name], tt.want[name]) {
+					t.Errorf("%s = %v, want %v", name, got[name], tt.want[name])
+				}
+				total += len(got[name])
+			}
+			if total != len(paths) {
+				t.Errorf("split %d of %d images", total, len(paths))
+			}
+		})
+	}
+}
+
+func TestParseRatios(t *testing.T) {
+	tests := []struct {
+		str     string
+		want    [3]float64
+		wantErr bool
+	}{
+		{str: "0.7,0.15,0.15", want: [3]float64{0.7, 0.15, 0.15}},
+		{str: "80,20", want: [3]float64{80, 20, 0}},
+		{str: " 0.6 , 0.2 , 0.2 ", want: [3]float64{0.6, 0.2, 0.2}},
+		{str: "", wantErr: true},
+		{str: "0.7", wantErr: true},
+		{str: "0.7;0.3", wantErr: true},
+		{str: "0.4,0.2,0.2,0.2", wantErr: true},
+		{str: "0.7,,0.3", wantErr: true},
+		{str: "seventy,thirty", wantErr: true},
+		{str: "70%,30%", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.str, func(t *testing.T) {
+			train, validation, test, err := ParseRatios(tt.str)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseRatios(%q) = %v, %v, %v, want an error", tt.str, train, validation, test)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := [3]float64{train, validation, test}; got != tt.want {
+				t.Errorf("ParseRatios(%q) = %v, want %v", tt.str, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"os"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// GetCacheStats returns the number of cached and pending images, the size of the thumbnails and
+// previews, and the size of the database files.
+func (db *DB) GetCacheStats() (data.CacheStats, error) {
+	var stats data.CacheStats
+	err := db.conn.QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE `+isCached+`), COUNT(*) FILTER (WHERE `+isPending+`),
+			COALESCE(SUM(LENGTH(thumbnail)), 0), COALESCE(SUM(LENGTH(preview)), 0)
+		FROM thumbnails
+	`).Scan(&stats.Images, &stats.Pending, &stats.Thumbnails, &stats.Previews)
+	if err != nil {
+		return stats, err
+	}
+
+	for _, suffix := range []string{"", "-wal"} {
+		if info, err := os.Stat(db.path + suffix); err == nil {
+			stats.File += info.Size()
+		}
+	}
+
+	return stats, nil
+}
+
+// Vacuum rebuilds the database file to give back the space left by removed images, and
+// truncates the write-ahead log.
+func (db *DB) Vacuum() error {
+	if _, err := db.conn.Exec("VACUUM"); err != nil {
+		return err
+	}
+
+	_, err := db.conn.Exec("PRAGMA wal_checkpoint(TRUNCATE)")
+	return err
+}
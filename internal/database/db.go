@@ -3,36 +3,71 @@ package database
 import (
 	"bytes"
 	"database/sql"
+	"fmt"
 	"image"
 	"image/jpeg"
 	"log"
 	"path/filepath"
+	"slices"
 
+	"github.com/coolapso/picsort/internal/data"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 const (
-	currentSchemaVersion = 1
+	currentSchemaVersion = 5
 	dbFileName           = ".picsort.db"
 )
 
 type DB struct {
 	conn *sql.DB
+	// root is the absolute path of the dataset, image paths are stored relative to it so the
+	// dataset can be moved or copied along with its database.
+	root string
+	// path is the database file.
+	path string
 }
 
+// CachedImage is an image scaled down to its thumbnail and preview.
 type CachedImage struct {
 	Thumbnail image.Image
 	Preview   image.Image
+	Stat      data.FileStat
+	Hashes    data.PerceptualHashes
+	// Quality is the JPEG quality the thumbnail and preview are stored with, the jpeg package
+	// default when 0.
+	Quality int
 }
 
-func New(datasetPath string) (*DB, error) {
-	dbPath := filepath.Join(datasetPath, dbFileName)
+// EncodedImage is the thumbnail and preview of the image at Path encoded as stored in the
+// database, see CachedImage.Encode.
+type EncodedImage struct {
+	Path      string
+	Thumbnail []byte
+	Preview   []byte
+	Stat      data.FileStat
+	Hashes    data.PerceptualHashes
+}
+
+// New opens the database of the dataset at datasetPath, creating it if needed. See Locate for
+// where the database is stored.
+func New(datasetPath string, external bool) (*DB, error) {
+	root, err := filepath.Abs(datasetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	dbPath, err := Locate(root, external)
+	if err != nil {
+		return nil, err
+	}
+
 	conn, err := sql.Open("sqlite3", dbPath+"?_journal=WAL")
 	if err != nil {
 		return nil, err
 	}
 
-	db := &DB{conn: conn}
+	db := &DB{conn: conn, root: root, path: dbPath}
 	//nolint:errcheck
 	if err := db.migrate(); err != nil {
 		conn.Close()
@@ -42,63 +77,49 @@ func New(datasetPath string) (*DB, error) {
 	return db, nil
 }
 
+// Path returns the path of the database file.
+func (db *DB) Path() string {
+	return db.path
+}
+
 func (db *DB) Close() {
 	//nolint:errcheck
 	db.conn.Close()
 }
 
-func (db *DB) migrate() error {
-	_, err := db.conn.Exec(`
-		CREATE TABLE IF NOT EXISTS metadata (
-			key TEXT PRIMARY KEY,
-			value TEXT
-		);
-
-		CREATE TABLE IF NOT EXISTS thumbnails (
-			path TEXT PRIMARY KEY,
-			thumbnail BLOB,
-			preview BLOB
-		);
-
-		CREATE TABLE IF NOT EXISTS image_bins (
-			image_path TEXT NOT NULL,
-			bin_id INTEGER NOT NULL,
-			PRIMARY KEY (image_path, bin_id),
-			FOREIGN KEY (image_path) REFERENCES thumbnails(path) ON DELETE CASCADE
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_iamge_bins_bin_id ON image_bins(bin_id);
-	`)
+// GetMetadata returns the value stored for key in the metadata table, or an empty
+// string if the key was never set.
+func (db *DB) GetMetadata(key string) (string, error) {
+	var value string
+	err := db.conn.QueryRow("SELECT value FROM metadata WHERE key = ?", key).Scan(&value)
 	if err != nil {
-		return err
-	}
-
-	var version int
-	err = db.conn.QueryRow("SELECT value FROM metadata WHERE key = 'schema_version'").Scan(&version)
-	if err != nil && err != sql.ErrNoRows {
-		return err
-	}
-
-	if version < currentSchemaVersion {
-		log.Printf("initializing schema version %d", currentSchemaVersion)
-		_, err = db.conn.Exec("INSERT OR REPLACE INTO metadata (key, value) VALUES ('schema_version', ?)", currentSchemaVersion)
-		if err != nil {
-			return err
+		if err == sql.ErrNoRows {
+			return "", nil
 		}
+		return "", err
 	}
 
-	return nil
+	return value, nil
+}
+
+func (db *DB) SetMetadata(key, value string) error {
+	_, err := db.conn.Exec("INSERT OR REPLACE INTO metadata (key, value) VALUES (?, ?)", key, value)
+	return err
 }
 
 func (db *DB) GetThumbnail(path string) (image.Image, bool) {
 	var data []byte
-	err := db.conn.QueryRow("SELECT thumbnail FROM thumbnails WHERE path = ?", path).Scan(&data)
+	err := db.conn.QueryRow("SELECT thumbnail FROM thumbnails WHERE path = ?", db.rel(path)).Scan(&data)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			log.Printf("error getting thumbnail from DB for %s: %v", path, err)
 		}
 		return nil, false
 	}
+	// images waiting to be cached have no thumbnail yet
+	if data == nil {
+		return nil, false
+	}
 
 	img, err := jpeg.Decode(bytes.NewReader(data))
 	if err != nil {
@@ -110,13 +131,17 @@ func (db *DB) GetThumbnail(path string) (image.Image, bool) {
 
 func (db *DB) GetPreview(path string) (image.Image, bool) {
 	var data []byte
-	err := db.conn.QueryRow("SELECT preview FROM thumbnails WHERE path = ?", path).Scan(&data)
+	err := db.conn.QueryRow("SELECT preview FROM thumbnails WHERE path = ?", db.rel(path)).Scan(&data)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			log.Printf("error getting preview from DB for %s: %v", path, err)
 		}
 		return nil, false
 	}
+	// images waiting to be cached have no preview yet
+	if data == nil {
+		return nil, false
+	}
 
 	img, err := jpeg.Decode(bytes.NewBuffer(data))
 	if err != nil {
@@ -126,17 +151,42 @@ func (db *DB) GetPreview(path string) (image.Image, bool) {
 	return img, true
 }
 
-func (db *DB) SetImage(path string, imgData CachedImage) error {
-	return db.SetImages(map[string]CachedImage{path: imgData})
+// Encode encodes the thumbnail and preview of the image at path as JPEG, ready to be stored.
+func (i CachedImage) Encode(path string) (EncodedImage, error) {
+	var options *jpeg.Options
+	if i.Quality > 0 {
+		options = &jpeg.Options{Quality: i.Quality}
+	}
+
+	var thumbBuf, previewBuf bytes.Buffer
+	if err := jpeg.Encode(&thumbBuf, i.Thumbnail, options); err != nil {
+		return EncodedImage{}, fmt.Errorf("could not encode thumbnail of %s: %v", path, err)
+	}
+	if err := jpeg.Encode(&previewBuf, i.Preview, options); err != nil {
+		return EncodedImage{}, fmt.Errorf("could not encode preview of %s: %v", path, err)
+	}
+
+	return EncodedImage{
+		Path:      path,
+		Thumbnail: thumbBuf.Bytes(),
+		Preview:   previewBuf.Bytes(),
+		Stat:      i.Stat,
+		Hashes:    i.Hashes,
+	}, nil
 }
 
-func (db *DB) SetImages(images map[string]CachedImage) error {
+// SetImages stores the thumbnails and previews of images in a single transaction, new images go
+// to the "To Sort" bin. Nothing is stored if any image fails.
+func (db *DB) SetImages(images []EncodedImage) error {
 	tx, err := db.conn.Begin()
 	if err != nil {
 		return err
 	}
 
-	imgStmt, err := tx.Prepare("INSERT OR REPLACE INTO thumbnails (path, thumbnail, preview) VALUES (?, ?, ?)")
+	imgStmt, err := tx.Prepare(`
+		INSERT OR REPLACE INTO thumbnails (path, thumbnail, preview, size, mod_time, hash, a_hash, d_hash, p_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
 	if err != nil {
 		//nolint:errcheck
 		tx.Rollback()
@@ -158,26 +208,19 @@ func (db *DB) SetImages(images map[string]CachedImage) error {
 	//nolint:errcheck
 	defer binStmt.Close()
 
-	for path, imgData := range images {
-		var thumBuf, previewBuf bytes.Buffer
-		if err := jpeg.Encode(&thumBuf, imgData.Thumbnail, nil); err != nil {
-			log.Printf("Error encoding thumbnail for %s: %v", path, err)
-			continue
-		}
-
-		if err := jpeg.Encode(&previewBuf, imgData.Preview, nil); err != nil {
-			log.Printf("Error encoding  preview for %s: %v", path, err)
-			continue
-		}
-
-		if _, err := imgStmt.Exec(path, thumBuf.Bytes(), previewBuf.Bytes()); err != nil {
-			log.Printf("Error executing img batch statement for %s: %v", path, err)
-			continue
+	for _, img := range images {
+		stat, hashes := img.Stat, img.Hashes
+		_, err := imgStmt.Exec(
+			db.rel(img.Path), img.Thumbnail, img.Preview, stat.Size, stat.ModTime, stat.Hash,
+			int64(hashes.Average), int64(hashes.Difference), int64(hashes.Perceptual),
+		)
+		if err == nil {
+			_, err = binStmt.Exec(db.rel(img.Path), db.rel(img.Path))
 		}
-
-		if _, err := binStmt.Exec(path, path); err != nil {
-			log.Printf("Error executing bin batch statement for bin %s: %v", path, err)
-			continue
+		if err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return fmt.Errorf("could not store %s: %w", img.Path, err)
 		}
 	}
 
@@ -200,7 +243,7 @@ func (db *DB) GetImagePaths(binID int) ([]string, error) {
 		if err := rows.Scan(&path); err != nil {
 			return nil, err
 		}
-		paths = append(paths, path)
+		paths = append(paths, db.abs(path))
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -211,7 +254,7 @@ func (db *DB) GetImagePaths(binID int) ([]string, error) {
 
 // CopyImageToBin adds an image to a new bin without removing it from existing ones.
 func (db *DB) AddImageToBin(path string, destID int) error {
-	_, err := db.conn.Exec("INSERT OR IGNORE INTO image_bins (image_path, bin_id) VALUES (?, ?)", path, destID)
+	_, err := db.conn.Exec("INSERT OR IGNORE INTO image_bins (image_path, bin_id) VALUES (?, ?)", db.rel(path), destID)
 	return err
 }
 
@@ -221,7 +264,7 @@ func (db *DB) UpdateImages(paths []string, sourceID, destID int) error {
 		return err
 	}
 
-	stmt, err := tx.Prepare("UPDATE image_bins SET bin_id = ? WHERE image_path = ? AND bin_id = ?")
+	stmt, err := tx.Prepare("UPDATE OR IGNORE image_bins SET bin_id = ? WHERE image_path = ? AND bin_id = ?")
 	if err != nil {
 		//nolint:errcheck
 		tx.Rollback()
@@ -230,10 +273,23 @@ func (db *DB) UpdateImages(paths []string, sourceID, destID int) error {
 	//nolint:errcheck
 	defer stmt.Close()
 
+	var changes []data.BinChange
 	for _, path := range paths {
-		if _, err := stmt.Exec(destID, path, sourceID); err != nil {
+		result, err := stmt.Exec(destID, db.rel(path), sourceID)
+		if err != nil {
 			log.Printf("Error executing batch update for %s: %v", path, err)
+			continue
 		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			changes = append(changes, data.BinChange{Path: db.rel(path), From: sourceID, To: destID})
+		}
+	}
+
+	entry := data.HistoryEntry{Action: data.HistoryMove, SourceID: sourceID, DestID: destID, Changes: changes}
+	if err := recordHistory(tx, entry); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
 	}
 
 	return tx.Commit()
@@ -254,23 +310,192 @@ func (db *DB) AddImagesToBin(paths []string, destID int) error {
 	//nolint:errcheck
 	defer stmt.Close()
 
+	var changes []data.BinChange
 	for _, path := range paths {
-		if _, err := stmt.Exec(path, destID); err != nil {
+		result, err := stmt.Exec(db.rel(path), destID)
+		if err != nil {
 			log.Printf("Error executing batch insert for %s: %v", path, err)
+			continue
 		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			changes = append(changes, data.BinChange{Path: db.rel(path), From: data.NoBin, To: destID})
+		}
+	}
+
+	entry := data.HistoryEntry{Action: data.HistoryAdd, SourceID: data.NoBin, DestID: destID, Changes: changes}
+	if err := recordHistory(tx, entry); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
 	}
 
 	return tx.Commit()
 }
 
-// RemoveImages deletes images from the database.
+// RemoveImages deletes images from the database, along with their bins and split pins.
 func (db *DB) RemoveImages(paths []string) error {
 	tx, err := db.conn.Begin()
 	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.Prepare("DELETE FROM thumbnails WHERE path = ?")
+	queries := []string{
+		"DELETE FROM thumbnails WHERE path = ?",
+		"DELETE FROM image_bins WHERE image_path = ?",
+		"DELETE FROM split_pins WHERE image_path = ?",
+	}
+	for _, query := range queries {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return err
+		}
+
+		for _, path := range paths {
+			if _, err := stmt.Exec(db.rel(path)); err != nil {
+				log.Printf("Error executing batch delete for %s: %v", path, err)
+			}
+		}
+		//nolint:errcheck
+		stmt.Close()
+	}
+
+	return tx.Commit()
+}
+
+// RenameImages changes the path of images that were renamed or moved, keeping their cache,
+// bins and split pins. renames maps old paths to new ones.
+func (db *DB) RenameImages(renames map[string]string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	// an image waiting to be cached at the new path is replaced by the renamed one
+	for _, newPath := range renames {
+		if err := dropPendingImage(tx, db.rel(newPath)); err != nil {
+			log.Printf("Error dropping pending image %s: %v", newPath, err)
+		}
+	}
+
+	queries := []string{
+		"UPDATE OR IGNORE thumbnails SET path = ? WHERE path = ?",
+		"UPDATE OR IGNORE image_bins SET image_path = ? WHERE image_path = ?",
+		"UPDATE OR IGNORE split_pins SET image_path = ? WHERE image_path = ?",
+	}
+	for _, query := range queries {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return err
+		}
+
+		for oldPath, newPath := range renames {
+			if _, err := stmt.Exec(db.rel(newPath), db.rel(oldPath)); err != nil {
+				log.Printf("Error executing batch rename for %s: %v", oldPath, err)
+			}
+		}
+		//nolint:errcheck
+		stmt.Close()
+	}
+
+	return tx.Commit()
+}
+
+// GetImageStats returns the file stats recorded when each image was cached, keyed by path, in a
+// single query. Images waiting to be cached, or missing their thumbnail or preview, are left out so
+// comparing the stats with the dataset files tells which images need caching.
+func (db *DB) GetImageStats() (map[string]data.FileStat, error) {
+	rows, err := db.conn.Query("SELECT path, size, mod_time, hash FROM thumbnails WHERE " + isCached)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	stats := make(map[string]data.FileStat)
+	for rows.Next() {
+		var path string
+		var stat data.FileStat
+		if err := rows.Scan(&path, &stat.Size, &stat.ModTime, &stat.Hash); err != nil {
+			return nil, err
+		}
+		stats[db.abs(path)] = stat
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetImageStat returns the file stats recorded when an image was cached, and false if it is not
+// cached yet.
+func (db *DB) GetImageStat(path string) (data.FileStat, bool, error) {
+	var stat data.FileStat
+	err := db.conn.QueryRow("SELECT size, mod_time, hash FROM thumbnails WHERE path = ? AND "+isCached, db.rel(path)).Scan(&stat.Size, &stat.ModTime, &stat.Hash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return stat, false, nil
+		}
+		return stat, false, err
+	}
+
+	return stat, true, nil
+}
+
+// GetImageBins returns the ids of the bins holding any of the given images.
+func (db *DB) GetImageBins(paths []string) ([]int, error) {
+	stmt, err := db.conn.Prepare("SELECT bin_id FROM image_bins WHERE image_path = ?")
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer stmt.Close()
+
+	var ids []int
+	for _, path := range paths {
+		rows, err := stmt.Query(db.rel(path))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				//nolint:errcheck
+				rows.Close()
+				return nil, err
+			}
+			if !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+		//nolint:errcheck
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return ids, nil
+}
+
+// SetImageStat updates the file stats of a cached image whose contents did not change.
+func (db *DB) SetImageStat(path string, stat data.FileStat) error {
+	return db.SetImageStats(map[string]data.FileStat{path: stat})
+}
+
+// SetImageStats updates the file stats of cached images whose contents did not change in a
+// single transaction.
+func (db *DB) SetImageStats(stats map[string]data.FileStat) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("UPDATE thumbnails SET size = ?, mod_time = ?, hash = ? WHERE path = ?")
 	if err != nil {
 		//nolint:errcheck
 		tx.Rollback()
@@ -279,9 +504,11 @@ func (db *DB) RemoveImages(paths []string) error {
 	//nolint:errcheck
 	defer stmt.Close()
 
-	for _, path := range paths {
-		if _, err := stmt.Exec(path); err != nil {
-			log.Printf("Error executing batch delete for %s: %v", path, err)
+	for path, stat := range stats {
+		if _, err := stmt.Exec(stat.Size, stat.ModTime, stat.Hash, db.rel(path)); err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return fmt.Errorf("could not update file stats of %s: %w", path, err)
 		}
 	}
 
@@ -309,3 +536,194 @@ func (db *DB) GetLowestImageCount() (int, error) {
 
 	return count, nil
 }
+
+// GetBinCounts returns the number of images stored in each bin, keyed by bin id.
+func (db *DB) GetBinCounts() (map[int]int, error) {
+	rows, err := db.conn.Query("SELECT bin_id, COUNT(image_path) FROM image_bins GROUP BY bin_id")
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var binID, count int
+		if err := rows.Scan(&binID, &count); err != nil {
+			return nil, err
+		}
+		counts[binID] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// GetSplitPins returns the split each pinned image is assigned to, keyed by image path.
+func (db *DB) GetSplitPins() (map[string]string, error) {
+	rows, err := db.conn.Query("SELECT image_path, split FROM split_pins")
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	pins := make(map[string]string)
+	for rows.Next() {
+		var path, split string
+		if err := rows.Scan(&path, &split); err != nil {
+			return nil, err
+		}
+		pins[db.abs(path)] = split
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pins, nil
+}
+
+// PinSplits stores the split assignment of the given images, replacing existing pins.
+func (db *DB) PinSplits(pins map[string]string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT OR REPLACE INTO split_pins (image_path, split) VALUES (?, ?)")
+	if err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
+	}
+	//nolint:errcheck
+	defer stmt.Close()
+
+	for path, split := range pins {
+		if _, err := stmt.Exec(db.rel(path), split); err != nil {
+			log.Printf("Error executing batch pin for %s: %v", path, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ClearSplitPins removes all split assignments.
+func (db *DB) ClearSplitPins() error {
+	_, err := db.conn.Exec("DELETE FROM split_pins")
+	return err
+}
+
+// GetBinNames returns the name given to each bin, bins without a name are not included.
+func (db *DB) GetBinNames() (map[int]string, error) {
+	rows, err := db.conn.Query("SELECT id, name FROM bins WHERE name != ''")
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	names := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
+}
+
+// GetHighestBinID returns the highest id of any bin holding images, named, or referenced by the
+// history, including bins removed since.
+func (db *DB) GetHighestBinID() (int, error) {
+	var id int
+	err := db.conn.QueryRow(`
+		SELECT IFNULL(MAX(id), 0) FROM (
+			SELECT MAX(bin_id) AS id FROM image_bins
+			UNION ALL SELECT MAX(id) FROM bins
+			UNION ALL SELECT MAX(source_id) FROM history
+			UNION ALL SELECT MAX(dest_id) FROM history
+		)
+	`).Scan(&id)
+
+	return id, err
+}
+
+// SetBinName names a bin, an empty name removes it.
+func (db *DB) SetBinName(id int, name string) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO bins (id, name) VALUES (?, ?)
+		ON CONFLICT(id) DO UPDATE SET name = excluded.name
+	`, id, name)
+	return err
+}
+
+// RemoveBin moves every image in a bin to destID and forgets the bin name, in a single
+// transaction. Images already in destID are simply dropped from the removed bin.
+func (db *DB) RemoveBin(id, destID int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := removeBin(tx, id, destID); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func removeBin(tx *sql.Tx, id, destID int) error {
+	entry := data.HistoryEntry{Action: data.HistoryRemoveBin, SourceID: id, DestID: destID}
+	err := tx.QueryRow("SELECT name FROM bins WHERE id = ?", id).Scan(&entry.BinName)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT image_path, EXISTS (SELECT 1 FROM image_bins d WHERE d.image_path = s.image_path AND d.bin_id = ?)
+		FROM image_bins s WHERE s.bin_id = ?
+	`, destID, id)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var path string
+		var inDest bool
+		if err := rows.Scan(&path, &inDest); err != nil {
+			//nolint:errcheck
+			rows.Close()
+			return err
+		}
+		change := data.BinChange{Path: path, From: id, To: destID}
+		if inDest {
+			change.To = data.NoBin
+		}
+		entry.Changes = append(entry.Changes, change)
+	}
+	//nolint:errcheck
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if err := applyChanges(tx, entry.Changes); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM bins WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return recordHistory(tx, entry)
+}
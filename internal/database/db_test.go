@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// encodedImages returns n images of the dataset at root, with blobs the size of small thumbnails
+// and previews, large enough for the previews to overflow into pages of their own.
+func encodedImages(root string, n int) []EncodedImage {
+	thumbnail, preview := make([]byte, 1<<10), make([]byte, 8<<10)
+	images := make([]EncodedImage, n)
+	for i := range images {
+		images[i] = EncodedImage{
+			Path:      filepath.Join(root, fmt.Sprintf("img%05d.jpg", i)),
+			Thumbnail: thumbnail,
+			Preview:   preview,
+			Stat:      data.FileStat{Size: int64(len(preview)), ModTime: int64(i), Hash: fmt.Sprintf("%064x", i)},
+		}
+	}
+	return images
+}
+
+func BenchmarkGetImageStats(b *testing.B) {
+	const cached, pending = 15000, 5000
+	root := b.TempDir()
+	db, err := New(root, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	images := encodedImages(root, cached+pending)
+	if err := db.SetImages(images[:cached]); err != nil {
+		b.Fatal(err)
+	}
+	paths := make([]string, pending)
+	for i, img := range images[cached:] {
+		paths[i] = img.Path
+	}
+	if err := db.AddPendingImages(paths); err != nil {
+		b.Fatal(err)
+	}
+
+	for b.Loop() {
+		stats, err := db.GetImageStats()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(stats) != cached {
+			b.Fatalf("got the stats of %d images, want %d", len(stats), cached)
+		}
+	}
+}
+
+// BenchmarkSetImages compares storing the images cached in the background a batch at a time, as
+// the cache writer does with batches of its cacheBatchSize, with storing them one at a time.
+func BenchmarkSetImages(b *testing.B) {
+	const count, batchSize = 1024, 64
+	for _, size := range []int{1, batchSize} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			root := b.TempDir()
+			db, err := New(root, false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer db.Close()
+
+			images := encodedImages(root, count)
+			for b.Loop() {
+				for batch := range slices.Chunk(images, size) {
+					if err := db.SetImages(batch); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*count), "ns/image")
+		})
+	}
+}
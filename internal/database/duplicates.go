@@ -0,0 +1,166 @@
+package database
+
+import (
+	"slices"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// GetDuplicates returns the groups of cached images with byte-identical contents, each group
+// sorted by path.
+func (db *DB) GetDuplicates() ([][]string, error) {
+	rows, err := db.conn.Query(`
+		SELECT hash, path FROM thumbnails
+		WHERE hash IN (SELECT hash FROM thumbnails WHERE hash != '' GROUP BY hash HAVING COUNT(*) > 1)
+		ORDER BY hash, path
+	`)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var groups [][]string
+	var previous string
+	for rows.Next() {
+		var hash, path string
+		if err := rows.Scan(&hash, &path); err != nil {
+			return nil, err
+		}
+		if hash != previous || len(groups) == 0 {
+			groups = append(groups, nil)
+			previous = hash
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], db.abs(path))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// ExcludeImages moves images from whatever bins they are in to the excluded bin.
+func (db *DB) ExcludeImages(paths []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	entry := data.HistoryEntry{Action: data.HistoryExclude, SourceID: data.NoBin, DestID: -1}
+	for _, path := range paths {
+		path = db.rel(path)
+		rows, err := tx.Query("SELECT bin_id FROM image_bins WHERE image_path = ? ORDER BY bin_id", path)
+		if err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return err
+		}
+
+		var bins []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				//nolint:errcheck
+				rows.Close()
+				//nolint:errcheck
+				tx.Rollback()
+				return err
+			}
+			bins = append(bins, id)
+		}
+		//nolint:errcheck
+		rows.Close()
+
+		excluded := slices.Contains(bins, -1)
+		for _, id := range bins {
+			if id == -1 {
+				continue
+			}
+			// the image ends up in the excluded bin once, other bins are just left
+			change := data.BinChange{Path: path, From: id, To: -1}
+			if excluded {
+				change.To = data.NoBin
+			}
+			excluded = true
+			entry.Changes = append(entry.Changes, change)
+		}
+	}
+
+	if err := applyChanges(tx, entry.Changes); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordHistory(tx, entry); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPerceptualHashes returns the perceptual hashes of the cached images, keyed by path.
+// Images whose hashes were not computed yet are left out.
+func (db *DB) GetPerceptualHashes() (map[string]data.PerceptualHashes, error) {
+	rows, err := db.conn.Query("SELECT path, a_hash, d_hash, p_hash FROM thumbnails WHERE p_hash IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	hashes := make(map[string]data.PerceptualHashes)
+	for rows.Next() {
+		var path string
+		var average, difference, perceptual int64
+		if err := rows.Scan(&path, &average, &difference, &perceptual); err != nil {
+			return nil, err
+		}
+		hashes[db.abs(path)] = data.PerceptualHashes{
+			Average:    uint64(average),
+			Difference: uint64(difference),
+			Perceptual: uint64(perceptual),
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// GetUnhashedImages returns the cached images whose perceptual hashes were not computed yet,
+// which are the ones cached before perceptual hashes were introduced.
+func (db *DB) GetUnhashedImages() ([]string, error) {
+	rows, err := db.conn.Query("SELECT path FROM thumbnails WHERE p_hash IS NULL AND " + isCached)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		paths = append(paths, db.abs(path))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+func (db *DB) SetPerceptualHashes(path string, hashes data.PerceptualHashes) error {
+	_, err := db.conn.Exec(
+		"UPDATE thumbnails SET a_hash = ?, d_hash = ?, p_hash = ? WHERE path = ?",
+		int64(hashes.Average), int64(hashes.Difference), int64(hashes.Perceptual), db.rel(path),
+	)
+	return err
+}
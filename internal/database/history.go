@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// maxHistory is the number of operations kept in the history, older ones can no longer be undone.
+const maxHistory = 1000
+
+// recordHistory stores an operation in the history, discarding the operations that were
+// undone since they can no longer be redone. Operations that changed nothing are not recorded.
+func recordHistory(tx *sql.Tx, entry data.HistoryEntry) error {
+	if len(entry.Changes) == 0 && entry.Action != data.HistoryRemoveBin {
+		return nil
+	}
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM history WHERE undone = 1"); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO history (action, source_id, dest_id, bin_name, changes) VALUES (?, ?, ?, ?, ?)",
+		entry.Action, entry.SourceID, entry.DestID, entry.BinName, changes,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM history WHERE id <= (SELECT MAX(id) FROM history) - ?", maxHistory)
+	return err
+}
+
+// applyChanges applies bin changes in order.
+func applyChanges(tx *sql.Tx, changes []data.BinChange) error {
+	for _, change := range changes {
+		var err error
+		switch {
+		case change.From == data.NoBin:
+			// images removed from the dataset since are not brought back
+			_, err = tx.Exec(`
+				INSERT OR IGNORE INTO image_bins (image_path, bin_id)
+				SELECT ?, ? WHERE EXISTS (SELECT 1 FROM thumbnails WHERE path = ?)
+			`, change.Path, change.To, change.Path)
+		case change.To == data.NoBin:
+			_, err = tx.Exec("DELETE FROM image_bins WHERE image_path = ? AND bin_id = ?", change.Path, change.From)
+		default:
+			_, err = tx.Exec("UPDATE OR IGNORE image_bins SET bin_id = ? WHERE image_path = ? AND bin_id = ?", change.To, change.Path, change.From)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func scanHistoryEntry(row interface{ Scan(...any) error }) (data.HistoryEntry, error) {
+	var entry data.HistoryEntry
+	var changes string
+	err := row.Scan(&entry.ID, &entry.Action, &entry.SourceID, &entry.DestID, &entry.BinName, &changes, &entry.Undone, &entry.Time)
+	if err != nil {
+		return entry, err
+	}
+
+	return entry, json.Unmarshal([]byte(changes), &entry.Changes)
+}
+
+const historyColumns = "id, action, source_id, dest_id, bin_name, changes, undone, created_at"
+
+// GetHistory returns the last limit operations, most recent first.
+func (db *DB) GetHistory(limit int) ([]data.HistoryEntry, error) {
+	rows, err := db.conn.Query("SELECT "+historyColumns+" FROM history ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var entries []data.HistoryEntry
+	for rows.Next() {
+		entry, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Undo reverts the last operation that was not undone yet, and returns it. It returns
+// false if there is nothing to undo.
+func (db *DB) Undo() (data.HistoryEntry, bool, error) {
+	return db.step("SELECT "+historyColumns+" FROM history WHERE undone = 0 ORDER BY id DESC LIMIT 1", true)
+}
+
+// Redo applies again the first operation that was undone, and returns it. It returns
+// false if there is nothing to redo.
+func (db *DB) Redo() (data.HistoryEntry, bool, error) {
+	return db.step("SELECT "+historyColumns+" FROM history WHERE undone = 1 ORDER BY id ASC LIMIT 1", false)
+}
+
+func (db *DB) step(query string, undo bool) (data.HistoryEntry, bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return data.HistoryEntry{}, false, err
+	}
+
+	entry, err := scanHistoryEntry(tx.QueryRow(query))
+	if err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return entry, false, nil
+		}
+		return entry, false, err
+	}
+
+	changes := entry.Changes
+	if undo {
+		changes = make([]data.BinChange, len(entry.Changes))
+		for i, change := range entry.Changes {
+			changes[len(changes)-1-i] = change.Reverse()
+		}
+	}
+
+	if err := applyChanges(tx, changes); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return entry, false, err
+	}
+
+	if entry.Action == data.HistoryRemoveBin {
+		if undo {
+			_, err = tx.Exec("INSERT OR REPLACE INTO bins (id, name) VALUES (?, ?)", entry.SourceID, entry.BinName)
+		} else {
+			_, err = tx.Exec("DELETE FROM bins WHERE id = ?", entry.SourceID)
+		}
+		if err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return entry, false, err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE history SET undone = ? WHERE id = ?", undo, entry.ID); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return entry, false, err
+	}
+
+	entry.Undone = undo
+	if err := tx.Commit(); err != nil {
+		log.Printf("error committing history step %d: %v", entry.ID, err)
+		return entry, false, err
+	}
+
+	return entry, true, nil
+}
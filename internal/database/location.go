@@ -0,0 +1,150 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// cacheDirEnv overrides the directory databases kept outside of their dataset are stored in.
+const cacheDirEnv = "PICSORT_CACHE_DIR"
+
+var errDatabaseExists = errors.New("a database already exists at the destination")
+
+// CacheDir returns the directory databases kept outside of their dataset are stored in,
+// $PICSORT_CACHE_DIR if set or picsort in the user cache directory, $XDG_CACHE_HOME on linux.
+func CacheDir() (string, error) {
+	if dir := os.Getenv(cacheDirEnv); dir != "" {
+		return filepath.Abs(dir)
+	}
+
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "picsort"), nil
+}
+
+// cachePath returns the path of the database of the dataset at root in the cache directory,
+// named after the dataset folder and keyed by its absolute path.
+func cachePath(root string) (string, error) {
+	dir, err := CacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(root))
+	name := fmt.Sprintf("%s-%s.db", filepath.Base(root), hex.EncodeToString(sum[:8]))
+	return filepath.Join(dir, name), nil
+}
+
+// IsExternal reports whether path is a database kept in the cache directory rather than in its dataset.
+func IsExternal(path string) bool {
+	return filepath.Base(path) != dbFileName
+}
+
+// Locate returns the path of the database of the dataset at root. An existing database is used
+// wherever it is, the dataset folder first. New databases go in the cache directory when external
+// is set or the dataset folder is not writable, like read-only mounts, and in the dataset otherwise.
+func Locate(root string, external bool) (string, error) {
+	inDataset := filepath.Join(root, dbFileName)
+	if _, err := os.Stat(inDataset); err == nil {
+		return inDataset, nil
+	}
+
+	cached, err := cachePath(root)
+	if err != nil {
+		if external {
+			return "", err
+		}
+		return inDataset, nil
+	}
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+
+	if !external && writable(root) {
+		return inDataset, nil
+	}
+
+	if !external {
+		log.Printf("%s is not writable, storing its database in %s", root, cached)
+	}
+
+	return cached, os.MkdirAll(filepath.Dir(cached), 0o755)
+}
+
+// writable reports whether files can be created in dir.
+func writable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".picsort-*")
+	if err != nil {
+		return false
+	}
+
+	//nolint:errcheck
+	f.Close()
+	//nolint:errcheck
+	os.Remove(f.Name())
+	return true
+}
+
+// Move moves the database of the dataset at datasetPath into the cache directory when external is
+// set, or into the dataset folder otherwise, and returns its new path. The database must not be open.
+func Move(datasetPath string, external bool) (string, error) {
+	root, err := filepath.Abs(datasetPath)
+	if err != nil {
+		return "", err
+	}
+
+	src, err := Locate(root, external)
+	if err != nil {
+		return "", err
+	}
+
+	dest := filepath.Join(root, dbFileName)
+	if external {
+		if dest, err = cachePath(root); err != nil {
+			return "", err
+		}
+	}
+
+	if src == dest {
+		return dest, nil
+	}
+
+	if _, err := os.Stat(src); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return "", fmt.Errorf("%w: %s", errDatabaseExists, dest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+
+	conn, err := sql.Open("sqlite3", src+"?_journal=WAL")
+	if err != nil {
+		return "", err
+	}
+	// VACUUM INTO writes a consistent copy including the pages still in the write-ahead log
+	_, err = conn.Exec("VACUUM INTO ?", dest)
+	//nolint:errcheck
+	conn.Close()
+	if err != nil {
+		return "", err
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Remove(src + suffix); err != nil && !os.IsNotExist(err) {
+			log.Printf("could not remove %s: %v", src+suffix, err)
+		}
+	}
+
+	return dest, nil
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+var errNewerSchema = errors.New("the database was created by a newer version of picsort")
+
+// migration upgrades the schema from the previous version to version.
+type migration struct {
+	version     int
+	description string
+	apply       func(db *DB, tx *sql.Tx) error
+}
+
+// migrations are applied in order, each in its own transaction. Released migrations must never
+// be changed, new schema changes are added as a new migration at the end of the list and
+// currentSchemaVersion bumped to its version.
+var migrations = []migration{
+	{1, "create the image and bin tables", migrateInitialSchema},
+	{2, "add bin names, history, split pins and file stats", migrateFileStats},
+	{3, "index images by content hash", migrateHashIndex},
+	{4, "add perceptual hashes", migratePerceptualHashes},
+	{5, "store image paths relative to the dataset", migrateRelativePaths},
+}
+
+func migrateInitialSchema(db *DB, tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS thumbnails (
+			path TEXT PRIMARY KEY,
+			thumbnail BLOB,
+			preview BLOB
+		);
+
+		CREATE TABLE IF NOT EXISTS image_bins (
+			image_path TEXT NOT NULL,
+			bin_id INTEGER NOT NULL,
+			PRIMARY KEY (image_path, bin_id),
+			FOREIGN KEY (image_path) REFERENCES thumbnails(path) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_iamge_bins_bin_id ON image_bins(bin_id);
+	`)
+	return err
+}
+
+// migrateFileStats adds the size, mod_time and hash of the cached files, used to detect changes
+// on rescans. Version 1 databases may already have the bins, history and split_pins tables.
+func migrateFileStats(db *DB, tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS bins (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL DEFAULT ''
+		);
+
+		CREATE TABLE IF NOT EXISTS history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			action TEXT NOT NULL,
+			source_id INTEGER NOT NULL,
+			dest_id INTEGER NOT NULL,
+			bin_name TEXT NOT NULL DEFAULT '',
+			changes TEXT NOT NULL,
+			undone INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS split_pins (
+			image_path TEXT PRIMARY KEY,
+			split TEXT NOT NULL,
+			FOREIGN KEY (image_path) REFERENCES thumbnails(path) ON DELETE CASCADE
+		);
+
+		ALTER TABLE thumbnails ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE thumbnails ADD COLUMN mod_time INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE thumbnails ADD COLUMN hash TEXT NOT NULL DEFAULT '';
+	`)
+	return err
+}
+
+// migrateHashIndex indexes the content hash, images are identified by their contents when they
+// are renamed, moved or duplicated.
+func migrateHashIndex(db *DB, tx *sql.Tx) error {
+	_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_thumbnails_hash ON thumbnails(hash)")
+	return err
+}
+
+// migratePerceptualHashes adds the perceptual hashes used to group near-duplicate images, they
+// are NULL until computed.
+func migratePerceptualHashes(db *DB, tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE thumbnails ADD COLUMN a_hash INTEGER;
+		ALTER TABLE thumbnails ADD COLUMN d_hash INTEGER;
+		ALTER TABLE thumbnails ADD COLUMN p_hash INTEGER;
+	`)
+	return err
+}
+
+func migrateRelativePaths(db *DB, tx *sql.Tx) error {
+	n, err := db.relativizePaths(tx, "")
+	if err != nil {
+		return err
+	}
+	log.Printf("rewrote %d image paths relative to the dataset", n)
+
+	return nil
+}
+
+// schemaVersion returns the schema version of the database, 0 for a new database.
+func (db *DB) schemaVersion() (int, error) {
+	var version int
+	err := db.conn.QueryRow("SELECT value FROM metadata WHERE key = 'schema_version'").Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// migrate brings the schema up to currentSchemaVersion. Existing databases are backed up before
+// being upgraded, and databases from a newer version are refused since older versions of picsort
+// can't know how to use them.
+func (db *DB) migrate() error {
+	_, err := db.conn.Exec(`
+		CREATE TABLE IF NOT EXISTS metadata (
+			key TEXT PRIMARY KEY,
+			value TEXT
+		);
+	`)
+	if err != nil {
+		return err
+	}
+
+	version, err := db.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if version > currentSchemaVersion {
+		return fmt.Errorf("%w: schema version %d, supported up to %d", errNewerSchema, version, currentSchemaVersion)
+	}
+
+	if version == currentSchemaVersion {
+		return nil
+	}
+
+	if version > 0 {
+		backup, err := db.backup(version)
+		if err != nil {
+			return fmt.Errorf("failed to back up the database before upgrading it: %w", err)
+		}
+		log.Printf("backed up schema version %d to %s", version, backup)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+
+		log.Printf("upgrading schema to version %d: %s", m.version, m.description)
+		if err := db.applyMigration(m); err != nil {
+			return fmt.Errorf("failed to upgrade schema to version %d: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs a migration and records the new schema version in a single transaction,
+// so a failed migration leaves the database at the previous version.
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := m.apply(db, tx); err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec("INSERT OR REPLACE INTO metadata (key, value) VALUES ('schema_version', ?)", m.version)
+	if err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// backup writes a consistent copy of the database next to it, named after its schema version,
+// and returns its path. A previous backup of the same version is replaced.
+func (db *DB) backup(version int) (string, error) {
+	path := fmt.Sprintf("%s.v%d.bak", db.path, version)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if _, err := db.conn.Exec("VACUUM INTO ?", path); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
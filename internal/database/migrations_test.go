@@ -0,0 +1,278 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// newFixture creates the database of a dataset in a temporary folder at schema version, the way
+// that version of picsort left it, with two images sorted into bins 1 and 2 by absolute path,
+// and returns the dataset folder.
+func newFixture(t *testing.T, version int) string {
+	t.Helper()
+	root := t.TempDir()
+	path := filepath.Join(root, dbFileName)
+	conn, err := sql.Open("sqlite3", path+"?_journal=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer conn.Close()
+
+	db := &DB{conn: conn, root: root, path: path}
+	if _, err := conn.Exec("CREATE TABLE metadata (key TEXT PRIMARY KEY, value TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:version] {
+		if err := db.applyMigration(m); err != nil {
+			t.Fatalf("building version %d fixture: %v", version, err)
+		}
+	}
+
+	a, b := filepath.Join(root, "a.jpg"), filepath.Join(root, "sub", "b.jpg")
+	statements := []string{
+		fmt.Sprintf("INSERT INTO thumbnails (path, thumbnail, preview) VALUES ('%s', X'01', X'01'), ('%s', X'01', X'01')", a, b),
+		fmt.Sprintf("INSERT INTO image_bins (image_path, bin_id) VALUES ('%s', 1), ('%s', 2)", a, b),
+	}
+	if version >= 2 {
+		statements = append(statements,
+			fmt.Sprintf("INSERT INTO split_pins (image_path, split) VALUES ('%s', 'training')", a),
+			"INSERT INTO history (action, source_id, dest_id, changes) VALUES ('move', 0, 1, '[]')",
+		)
+	}
+	for _, statement := range statements {
+		if _, err := conn.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+// baselineSchema is the schema of the databases created by picsort before it was versioned
+// beyond 1, with image paths stored absolute.
+const baselineSchema = `
+	CREATE TABLE IF NOT EXISTS metadata (
+		key TEXT PRIMARY KEY,
+		value TEXT
+	);
+
+	CREATE TABLE IF NOT EXISTS thumbnails (
+		path TEXT PRIMARY KEY,
+		thumbnail BLOB,
+		preview BLOB
+	);
+
+	CREATE TABLE IF NOT EXISTS image_bins (
+		image_path TEXT NOT NULL,
+		bin_id INTEGER NOT NULL,
+		PRIMARY KEY (image_path, bin_id),
+		FOREIGN KEY (image_path) REFERENCES thumbnails(path) ON DELETE CASCADE
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_iamge_bins_bin_id ON image_bins(bin_id);
+
+	INSERT OR REPLACE INTO metadata (key, value) VALUES ('schema_version', 1);
+`
+
+func queryStrings(t *testing.T, db *DB, query string) []string {
+	t.Helper()
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Sort(values)
+	return values
+}
+
+func TestMigrate(t *testing.T) {
+	for version := 1; version < currentSchemaVersion; version++ {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			root := newFixture(t, version)
+			db, err := New(root, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			if got, err := db.schemaVersion(); err != nil || got != currentSchemaVersion {
+				t.Fatalf("schema version = %d, %v, want %d", got, err, currentSchemaVersion)
+			}
+			if _, err := os.Stat(fmt.Sprintf("%s.v%d.bak", db.Path(), version)); err != nil {
+				t.Errorf("no backup of version %d: %v", version, err)
+			}
+
+			columns := queryStrings(t, db, "SELECT name FROM pragma_table_info('thumbnails')")
+			for _, column := range []string{"path", "thumbnail", "preview", "size", "mod_time", "hash", "a_hash", "d_hash", "p_hash"} {
+				if !slices.Contains(columns, column) {
+					t.Errorf("thumbnails has no %s column, has %v", column, columns)
+				}
+			}
+			objects := queryStrings(t, db, "SELECT name FROM sqlite_master WHERE type IN ('table', 'index')")
+			for _, name := range []string{"bins", "history", "split_pins", "image_bins", "idx_thumbnails_hash"} {
+				if !slices.Contains(objects, name) {
+					t.Errorf("no %s after migrating, have %v", name, objects)
+				}
+			}
+
+			want := []string{"a.jpg", "sub/b.jpg"}
+			if got := queryStrings(t, db, "SELECT path FROM thumbnails"); !slices.Equal(got, want) {
+				t.Errorf("thumbnail paths = %v, want %v", got, want)
+			}
+			if got := queryStrings(t, db, "SELECT image_path FROM image_bins"); !slices.Equal(got, want) {
+				t.Errorf("bin paths = %v, want %v", got, want)
+			}
+
+			for bin, name := range map[int]string{1: "a.jpg", 2: filepath.Join("sub", "b.jpg")} {
+				paths, err := db.GetImagePaths(bin)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := []string{filepath.Join(root, name)}; !slices.Equal(paths, want) {
+					t.Errorf("bin %d holds %v, want %v", bin, paths, want)
+				}
+			}
+
+			if version < 2 {
+				return
+			}
+			if got := queryStrings(t, db, "SELECT image_path FROM split_pins"); !slices.Equal(got, []string{"a.jpg"}) {
+				t.Errorf("split pin paths = %v, want [a.jpg]", got)
+			}
+			if got := queryStrings(t, db, "SELECT action FROM history"); !slices.Equal(got, []string{"move"}) {
+				t.Errorf("history = %v, want the move recorded before migrating", got)
+			}
+		})
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	root := newFixture(t, currentSchemaVersion)
+	conn, err := sql.Open("sqlite3", filepath.Join(root, dbFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.Exec("UPDATE metadata SET value = ? WHERE key = 'schema_version'", currentSchemaVersion+1)
+	//nolint:errcheck
+	conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(root, false)
+	if err == nil {
+		db.Close()
+		t.Fatal("a database from a newer version was opened")
+	}
+	if !errors.Is(err, errNewerSchema) {
+		t.Errorf("error = %v, want %v", err, errNewerSchema)
+	}
+}
+
+// TestMigrateBaselineDatabase upgrades a database as created by the first versioned picsort,
+// rather than by the migrations themselves.
+func TestMigrateBaselineDatabase(t *testing.T) {
+	root := t.TempDir()
+	conn, err := sql.Open("sqlite3", filepath.Join(root, dbFileName)+"?_journal=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(baselineSchema); err != nil {
+		t.Fatal(err)
+	}
+
+	var thumbnail bytes.Buffer
+	if err := jpeg.Encode(&thumbnail, image.NewGray(image.Rect(0, 0, 16, 12)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// a.jpg is sorted, sub/b.jpg waits in To Sort and c.jpg was added to two bins
+	bins := map[string][]int{"a.jpg": {1}, "sub/b.jpg": {0}, "c.jpg": {2, 3}}
+	for name, ids := range bins {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if _, err := conn.Exec("INSERT INTO thumbnails (path, thumbnail, preview) VALUES (?, ?, ?)", path, thumbnail.Bytes(), thumbnail.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range ids {
+			if _, err := conn.Exec("INSERT INTO image_bins (image_path, bin_id) VALUES (?, ?)", path, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	//nolint:errcheck
+	conn.Close()
+
+	db, err := New(root, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if got, err := db.schemaVersion(); err != nil || got != currentSchemaVersion {
+		t.Fatalf("schema version = %d, %v, want %d", got, err, currentSchemaVersion)
+	}
+	if got := queryStrings(t, db, "SELECT path FROM thumbnails"); !slices.Equal(got, []string{"a.jpg", "c.jpg", "sub/b.jpg"}) {
+		t.Errorf("thumbnail paths = %v, want them relative", got)
+	}
+
+	for bin, want := range map[int][]string{0: {"sub/b.jpg"}, 1: {"a.jpg"}, 2: {"c.jpg"}, 3: {"c.jpg"}} {
+		paths, err := db.GetImagePaths(bin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, name := range want {
+			want[i] = filepath.Join(root, filepath.FromSlash(name))
+		}
+		if !slices.Equal(paths, want) {
+			t.Errorf("bin %d holds %v, want %v", bin, paths, want)
+		}
+	}
+
+	a := filepath.Join(root, "a.jpg")
+	if img, ok := db.GetThumbnail(a); !ok || img == nil {
+		t.Error("thumbnail of a.jpg lost migrating")
+	}
+	if img, ok := db.GetPreview(a); !ok || img == nil {
+		t.Error("preview of a.jpg lost migrating")
+	}
+
+	// the history starts empty and records the moves made after migrating
+	if entries, err := db.GetHistory(10); err != nil || len(entries) != 0 {
+		t.Fatalf("history = %v, %v, want it empty", entries, err)
+	}
+	if err := db.UpdateImages([]string{a}, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := db.GetHistory(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []data.BinChange{{Path: "a.jpg", From: 1, To: 2}}
+	if len(entries) != 1 || entries[0].Action != data.HistoryMove || !slices.Equal(entries[0].Changes, want) {
+		t.Errorf("history = %+v, want the move of a.jpg from bin 1 to 2", entries)
+	}
+}
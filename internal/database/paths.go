@@ -0,0 +1,217 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// rel returns the path stored in the database for an image, relative to the dataset root and
+// slash separated so the database can be shared between systems. Paths outside of the dataset
+// are stored as they are.
+func (db *DB) rel(path string) string {
+	rel, err := filepath.Rel(db.root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return path
+	}
+
+	return filepath.ToSlash(rel)
+}
+
+// abs returns the absolute path of an image from the path stored in the database.
+func (db *DB) abs(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(db.root, filepath.FromSlash(path))
+}
+
+// relativizePaths rewrites the absolute image paths stored relative to the dataset root, and
+// returns how many were rewritten. Paths stored under oldRoot, or under a root guessed from
+// the images found in the dataset when oldRoot is empty, are rewritten relative to it, so
+// datasets that were moved since are repaired.
+func (db *DB) relativizePaths(tx *sql.Tx, oldRoot string) (int, error) {
+	rows, err := tx.Query(`
+		SELECT path FROM thumbnails
+		UNION SELECT image_path FROM image_bins
+		UNION SELECT image_path FROM split_pins
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	var absolute []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			//nolint:errcheck
+			rows.Close()
+			return 0, err
+		}
+		if filepath.IsAbs(path) {
+			absolute = append(absolute, path)
+		}
+	}
+	//nolint:errcheck
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	roots := []string{db.root}
+	if oldRoot != "" {
+		roots = append(roots, filepath.Clean(oldRoot))
+	}
+
+	renames := make(map[string]string)
+	for _, path := range absolute {
+		rel, ok := relativeTo(roots, path)
+		if !ok {
+			root, found := db.guessRoot(path)
+			if !found {
+				continue
+			}
+			roots = append(roots, root)
+			rel, _ = relativeTo(roots, path)
+		}
+		renames[path] = rel
+	}
+	if len(renames) == 0 {
+		return 0, nil
+	}
+
+	queries := []string{
+		"UPDATE OR IGNORE thumbnails SET path = ? WHERE path = ?",
+		"UPDATE OR IGNORE image_bins SET image_path = ? WHERE image_path = ?",
+		"UPDATE OR IGNORE split_pins SET image_path = ? WHERE image_path = ?",
+	}
+	for _, query := range queries {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			return 0, err
+		}
+		for oldPath, newPath := range renames {
+			if _, err := stmt.Exec(newPath, oldPath); err != nil {
+				//nolint:errcheck
+				stmt.Close()
+				return 0, err
+			}
+		}
+		//nolint:errcheck
+		stmt.Close()
+	}
+
+	return len(renames), relativizeHistory(tx, renames)
+}
+
+// relativeTo returns path relative to the first of roots it is in.
+func relativeTo(roots []string, path string) (string, bool) {
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err == nil && filepath.IsLocal(rel) {
+			return filepath.ToSlash(rel), true
+		}
+	}
+
+	return "", false
+}
+
+// guessRoot finds the root an image was stored under before the dataset moved, by looking for
+// the longest trailing part of its path that exists in the dataset.
+func (db *DB) guessRoot(path string) (string, bool) {
+	parts := strings.Split(filepath.ToSlash(path), "/")
+	for i := 1; i < len(parts); i++ {
+		rel := strings.Join(parts[i:], "/")
+		if _, err := os.Stat(filepath.Join(db.root, filepath.FromSlash(rel))); err == nil {
+			return filepath.FromSlash(strings.Join(parts[:i], "/")), true
+		}
+	}
+
+	return "", false
+}
+
+// relativizeHistory rewrites the image paths of the recorded operations.
+func relativizeHistory(tx *sql.Tx, renames map[string]string) error {
+	rows, err := tx.Query("SELECT id, changes FROM history")
+	if err != nil {
+		return err
+	}
+
+	updated := make(map[int64][]byte)
+	for rows.Next() {
+		var id int64
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			//nolint:errcheck
+			rows.Close()
+			return err
+		}
+
+		var changes []data.BinChange
+		if err := json.Unmarshal([]byte(value), &changes); err != nil {
+			//nolint:errcheck
+			rows.Close()
+			return err
+		}
+
+		rewritten := slices.ContainsFunc(changes, func(change data.BinChange) bool {
+			_, found := renames[change.Path]
+			return found
+		})
+		if !rewritten {
+			continue
+		}
+		for i, change := range changes {
+			if rel, found := renames[change.Path]; found {
+				changes[i].Path = rel
+			}
+		}
+
+		content, err := json.Marshal(changes)
+		if err != nil {
+			//nolint:errcheck
+			rows.Close()
+			return err
+		}
+		updated[id] = content
+	}
+	//nolint:errcheck
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, content := range updated {
+		if _, err := tx.Exec("UPDATE history SET changes = ? WHERE id = ?", content, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Relink repairs the database of a dataset that was moved, rewriting the absolute paths left
+// over from older versions relative to the dataset. oldRoot is where the dataset used to be,
+// if empty it is guessed from the images found in the dataset. It returns how many paths
+// were rewritten.
+func (db *DB) Relink(oldRoot string) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := db.relativizePaths(tx, oldRoot)
+	if err != nil {
+		//nolint:errcheck
+		tx.Rollback()
+		return 0, err
+	}
+
+	return n, tx.Commit()
+}
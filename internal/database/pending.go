@@ -0,0 +1,89 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+const (
+	// isCached matches the images whose thumbnail and preview were both generated. Checking the
+	// length of the blobs doesn't read them, so whole datasets are checked without decoding any image.
+	isCached = "(IFNULL(LENGTH(thumbnail), 0) > 0 AND IFNULL(LENGTH(preview), 0) > 0)"
+	// isPending matches the images waiting to be cached, and the ones whose thumbnail or preview
+	// went missing, which are cached again.
+	isPending = "NOT " + isCached
+)
+
+// AddPendingImages adds images waiting to be cached to the "To Sort" bin, so they can be shown
+// and sorted before their thumbnails and previews are generated. Pending images have no thumbnail.
+func (db *DB) AddPendingImages(paths []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	queries := []string{
+		"INSERT OR IGNORE INTO thumbnails (path) VALUES (?)",
+		"INSERT INTO image_bins (image_path, bin_id) SELECT ?1, 0 WHERE NOT EXISTS (SELECT 1 FROM image_bins WHERE image_path = ?1)",
+	}
+	for _, query := range queries {
+		stmt, err := tx.Prepare(query)
+		if err != nil {
+			//nolint:errcheck
+			tx.Rollback()
+			return err
+		}
+
+		for _, path := range paths {
+			if _, err := stmt.Exec(db.rel(path)); err != nil {
+				log.Printf("Error executing batch insert of pending image %s: %v", path, err)
+			}
+		}
+		//nolint:errcheck
+		stmt.Close()
+	}
+
+	return tx.Commit()
+}
+
+// GetPendingImages returns the images waiting to be cached.
+func (db *DB) GetPendingImages() (map[string]bool, error) {
+	rows, err := db.conn.Query("SELECT path FROM thumbnails WHERE " + isPending)
+	if err != nil {
+		return nil, err
+	}
+	//nolint:errcheck
+	defer rows.Close()
+
+	pending := make(map[string]bool)
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		pending[db.abs(path)] = true
+	}
+
+	return pending, rows.Err()
+}
+
+// IsPendingImage reports whether the image at path is stored and waiting to be cached.
+func (db *DB) IsPendingImage(path string) (bool, error) {
+	var pending bool
+	err := db.conn.QueryRow("SELECT EXISTS (SELECT 1 FROM thumbnails WHERE path = ? AND "+isPending+")", db.rel(path)).Scan(&pending)
+	return pending, err
+}
+
+// dropPendingImage removes the image stored at path if it is still waiting to be cached.
+func dropPendingImage(tx *sql.Tx, path string) error {
+	_, err := tx.Exec(`
+		DELETE FROM image_bins WHERE image_path = ?1
+		AND EXISTS (SELECT 1 FROM thumbnails WHERE path = ?1 AND `+isPending+`)
+	`, path)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM thumbnails WHERE path = ? AND "+isPending, path)
+	return err
+}
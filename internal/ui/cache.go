@@ -0,0 +1,181 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/coolapso/picsort/internal/controller"
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// externalCachePref is the preference deciding whether new dataset databases are created in the
+// cache directory instead of the dataset folder.
+const externalCachePref = "external_cache"
+
+const (
+	cacheInDataset  = "Dataset folder"
+	cacheInCacheDir = "Cache directory"
+)
+
+// describeCache returns how many images are cached and how much space they take.
+func describeCache(stats data.CacheStats) string {
+	return fmt.Sprintf("%d images, %s of thumbnails and %s of previews, %s on disk",
+		stats.Images, data.FormatSize(stats.Thumbnails), data.FormatSize(stats.Previews), data.FormatSize(stats.File))
+}
+
+// cacheDialog shows where the database of the open dataset is stored, how big it is and how
+// thumbnails and previews are generated. The database can be moved between the dataset folder
+// and the cache directory, the choice is remembered for new datasets, cleaned of missing images
+// and regenerated. Changing the settings regenerates the cache.
+func (p *PicsortUI) cacheDialog() {
+	path, external, err := p.controller.CachePath()
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+
+	pathLabel := widget.NewLabel(path)
+	pathLabel.Wrapping = fyne.TextWrapBreak
+	location := widget.NewRadioGroup([]string{cacheInDataset, cacheInCacheDir}, nil)
+	location.Required = true
+	location.SetSelected(cacheInDataset)
+	if external {
+		location.SetSelected(cacheInCacheDir)
+	}
+
+	summary := widget.NewLabel("")
+	refresh := func() {
+		stats, err := p.controller.GetCacheStats()
+		if err != nil {
+			p.ShowErrorDialog(err)
+			return
+		}
+		summary.SetText(describeCache(stats))
+	}
+	refresh()
+
+	config, err := p.controller.GetCacheConfig()
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+
+	thumbnailSize := widget.NewEntry()
+	thumbnailSize.SetText(strconv.FormatUint(uint64(config.ThumbnailSize), 10))
+	previewSize := widget.NewEntry()
+	previewSize.SetText(fmt.Sprintf("%dx%d", config.PreviewWidth, config.PreviewHeight))
+	filters := make([]string, len(data.ResizeFilters))
+	for i, filter := range data.ResizeFilters {
+		filters[i] = string(filter)
+	}
+	filter := widget.NewSelect(filters, nil)
+	filter.SetSelected(string(config.Filter))
+	quality := widget.NewEntry()
+	quality.SetText(strconv.Itoa(config.Quality))
+
+	readConfig := func() (data.CacheConfig, error) {
+		var c data.CacheConfig
+		size, err := strconv.ParseUint(thumbnailSize.Text, 10, 32)
+		if err != nil {
+			return c, fmt.Errorf("invalid thumbnail size: %v", err)
+		}
+		c.ThumbnailSize = uint(size)
+		if c.PreviewWidth, c.PreviewHeight, err = data.ParseSize(previewSize.Text); err != nil {
+			return c, fmt.Errorf("invalid preview size: %v", err)
+		}
+		c.Filter = data.ResizeFilter(filter.Selected)
+		if c.Quality, err = strconv.Atoi(quality.Text); err != nil {
+			return c, fmt.Errorf("invalid quality: %v", err)
+		}
+
+		return c, c.Validate()
+	}
+
+	thumbnailItem := widget.NewFormItem("Thumbnails", thumbnailSize)
+	thumbnailItem.HintText = "size in pixels thumbnails fit in"
+	previewItem := widget.NewFormItem("Previews", previewSize)
+	previewItem.HintText = "width x height previews fit in"
+	filterItem := widget.NewFormItem("Filter", filter)
+	filterItem.HintText = "from the fastest to the sharpest"
+	qualityItem := widget.NewFormItem("Quality", quality)
+	qualityItem.HintText = "JPEG quality from 1 to 100"
+	settings := widget.NewForm(thumbnailItem, previewItem, filterItem, qualityItem)
+
+	var d dialog.Dialog
+	var cleanCache func(force bool)
+	cleanCache = func(force bool) {
+		removed, err := p.controller.CleanCache(force)
+		if errors.Is(err, controller.ErrMostImagesMissing) {
+			dialog.ShowConfirm("Clean up", "Most images of the dataset are missing, remove them from the cache anyway?", func(confirmed bool) {
+				if confirmed {
+					cleanCache(true)
+				}
+			}, p.win)
+			return
+		}
+		if err != nil {
+			p.ShowErrorDialog(err)
+			return
+		}
+		if removed > 0 {
+			p.ReloadAll()
+		}
+		refresh()
+	}
+	clean := widget.NewButton("Clean up", func() {
+		cleanCache(false)
+	})
+	regenerate := widget.NewButton("Regenerate", func() {
+		d.Hide()
+		go p.controller.RegenerateCache(p.newLoad())
+	})
+
+	content := container.NewVBox(
+		widget.NewLabel("Thumbnails, previews and sorting data are stored in:"),
+		pathLabel,
+		location,
+		summary,
+		container.NewHBox(clean, regenerate),
+		settings,
+	)
+
+	d = dialog.NewCustomConfirm("Cache", "Apply", "Close", content, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		newConfig, err := readConfig()
+		if err != nil {
+			p.ShowErrorDialog(err)
+			return
+		}
+
+		toCacheDir := location.Selected == cacheInCacheDir
+		p.app.Preferences().SetBool(externalCachePref, toCacheDir)
+		p.controller.SetExternalCache(toCacheDir)
+		if toCacheDir != external {
+			if _, err := p.controller.MoveCache(toCacheDir); err != nil {
+				p.ShowErrorDialog(err)
+				return
+			}
+		}
+
+		if newConfig == config {
+			return
+		}
+		if err := p.controller.SetCacheConfig(newConfig); err != nil {
+			p.ShowErrorDialog(err)
+			return
+		}
+		go p.controller.RegenerateCache(p.newLoad())
+	}, p.win)
+	d.SetOnClosed(p.focusCurrentGrid)
+	d.Resize(fyne.NewSize(600, 500))
+	d.Show()
+}
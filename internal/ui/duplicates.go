@@ -0,0 +1,179 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+// maxGroupNames is the number of file names listed for each group of near-duplicates.
+const maxGroupNames = 5
+
+// describeDuplicates returns the file name and bins of each image in a group of duplicates.
+func (p *PicsortUI) describeDuplicates(group []string) string {
+	var copies []string
+	for _, path := range group {
+		bins, err := p.controller.GetImageBins(path)
+		if err != nil {
+			p.ShowErrorDialog(err)
+			return ""
+		}
+
+		var titles []string
+		for _, id := range bins {
+			titles = append(titles, p.binLabel(id))
+		}
+		copies = append(copies, fmt.Sprintf("%s (%s)", filepath.Base(path), strings.Join(titles, ", ")))
+	}
+
+	return fmt.Sprintf("%d identical images: %s", len(group), strings.Join(copies, ", "))
+}
+
+// describeNearDuplicates returns the file names of the first images in a cluster of near-duplicates.
+func describeNearDuplicates(cluster []string) string {
+	var names []string
+	for _, path := range cluster[:min(len(cluster), maxGroupNames)] {
+		names = append(names, filepath.Base(path))
+	}
+	if len(cluster) > maxGroupNames {
+		names = append(names, fmt.Sprintf("and %d more", len(cluster)-maxGroupNames))
+	}
+
+	return fmt.Sprintf("%d similar images: %s", len(cluster), strings.Join(names, ", "))
+}
+
+// newGroupList lists groups of images with the thumbnail of their first image, and a button
+// keeping a single image of the group and excluding the others.
+func (p *PicsortUI) newGroupList(groups *[][]string, describe func(group []string) string) *widget.List {
+	var list *widget.List
+	list = widget.NewList(
+		func() int { return len(*groups) },
+		func() fyne.CanvasObject {
+			thumb := canvas.NewImageFromImage(nil)
+			thumb.FillMode = canvas.ImageFillContain
+			thumb.SetMinSize(fyne.NewSize(64, 64))
+			label := widget.NewLabel("")
+			label.Wrapping = fyne.TextWrapWord
+			return container.NewBorder(nil, nil, thumb, widget.NewButton("Keep one", nil), label)
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			group := (*groups)[i]
+			row := o.(*fyne.Container)
+			row.Objects[0].(*widget.Label).SetText(describe(group))
+			thumb := row.Objects[1].(*canvas.Image)
+			thumb.Image = p.controller.GetThumbnail(group[0])
+			thumb.Refresh()
+			row.Objects[2].(*widget.Button).OnTapped = func() {
+				p.excludeCopies([][]string{group})
+				list.Refresh()
+			}
+			list.SetItemHeight(i, row.MinSize().Height)
+		},
+	)
+
+	return list
+}
+
+// excludeCopies keeps one image of each group and excludes the others.
+func (p *PicsortUI) excludeCopies(groups [][]string) {
+	if err := p.controller.ExcludeDuplicates(groups); err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+	p.ReloadAll()
+}
+
+// duplicatesDialog shows the groups of byte-identical images so the copies can be excluded
+// before exporting.
+func (p *PicsortUI) duplicatesDialog() {
+	groups, err := p.controller.GetDuplicates()
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+	if len(groups) == 0 {
+		d := dialog.NewInformation("Duplicates", "No duplicate images found.", p.win)
+		d.SetOnClosed(p.focusCurrentGrid)
+		d.Show()
+		return
+	}
+
+	list := p.newGroupList(&groups, p.describeDuplicates)
+	d := dialog.NewCustomConfirm(fmt.Sprintf("Duplicates (%d groups)", len(groups)), "Keep one of each", "Close", list, func(confirmed bool) {
+		if confirmed {
+			p.excludeCopies(groups)
+		}
+	}, p.win)
+	d.SetOnClosed(p.focusCurrentGrid)
+	d.Resize(fyne.NewSize(700, 500))
+	d.Show()
+}
+
+// nearDuplicatesDialog shows the clusters of near-duplicate images, regrouping them as the
+// hash algorithm and similarity threshold are changed. The chosen settings are stored in the
+// dataset and used by exports keeping clusters in a single split.
+func (p *PicsortUI) nearDuplicatesDialog() {
+	config, err := p.controller.GetClusterConfig()
+	if err != nil {
+		p.ShowErrorDialog(err)
+	}
+
+	var clusters [][]string
+	list := p.newGroupList(&clusters, describeNearDuplicates)
+	summary := widget.NewLabel("")
+	cluster := func() {
+		if err := p.controller.SetClusterConfig(config); err != nil {
+			p.ShowErrorDialog(err)
+			return
+		}
+		clusters, err = p.controller.GetNearDuplicates(config)
+		if err != nil {
+			p.ShowErrorDialog(err)
+			return
+		}
+		summary.SetText(fmt.Sprintf("%d clusters", len(clusters)))
+		list.Refresh()
+	}
+
+	algorithm := widget.NewSelect([]string{string(data.HashAverage), string(data.HashDifference), string(data.HashPerceptual)}, nil)
+	algorithm.SetSelected(string(config.Algorithm))
+	algorithm.OnChanged = func(selected string) {
+		config.Algorithm = data.HashAlgorithm(selected)
+		cluster()
+	}
+
+	thresholdLabel := widget.NewLabel(fmt.Sprintf("%d bits", config.Threshold))
+	threshold := widget.NewSlider(0, 32)
+	threshold.SetValue(float64(config.Threshold))
+	threshold.OnChanged = func(value float64) {
+		thresholdLabel.SetText(fmt.Sprintf("%d bits", int(value)))
+	}
+	threshold.OnChangeEnded = func(value float64) {
+		config.Threshold = int(value)
+		cluster()
+	}
+
+	settings := container.NewBorder(nil, nil,
+		container.NewHBox(widget.NewLabel("Hash"), algorithm, widget.NewLabel("Threshold")),
+		container.NewHBox(thresholdLabel, summary),
+		threshold,
+	)
+	cluster()
+
+	d := dialog.NewCustomConfirm("Near-duplicates", "Keep one of each", "Close", container.NewBorder(settings, nil, nil, nil, list), func(confirmed bool) {
+		if confirmed {
+			p.excludeCopies(clusters)
+		}
+	}, p.win)
+	d.SetOnClosed(p.focusCurrentGrid)
+	d.Resize(fyne.NewSize(800, 600))
+	d.Show()
+}
@@ -0,0 +1,120 @@
+package ui
+
+import (
+	"fmt"
+	"slices"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/coolapso/picsort/internal/data"
+)
+
+func (p *PicsortUI) undo() {
+	entry, ok, err := p.controller.Undo()
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+	if ok {
+		p.applyHistoryStep(entry)
+	}
+}
+
+func (p *PicsortUI) redo() {
+	entry, ok, err := p.controller.Redo()
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+	if ok {
+		p.applyHistoryStep(entry)
+	}
+}
+
+// applyHistoryStep brings the tabs in line with an operation that was just undone or redone.
+func (p *PicsortUI) applyHistoryStep(entry data.HistoryEntry) {
+	if entry.Action == data.HistoryRemoveBin {
+		position := slices.Index(p.binLayout, entry.SourceID)
+		switch {
+		case entry.Undone && position < 0:
+			p.addBin(entry.SourceID)
+			p.saveBinLayout()
+		case !entry.Undone && position >= 0:
+			delete(p.binGrids, entry.SourceID)
+			p.binLayout = slices.Delete(p.binLayout, position, position+1)
+			p.tabs.RemoveIndex(position)
+			p.saveBinLayout()
+		}
+	}
+
+	bins := []int{entry.SourceID, entry.DestID}
+	for _, change := range entry.Changes {
+		bins = append(bins, change.From, change.To)
+	}
+	slices.Sort(bins)
+	for _, id := range slices.Compact(bins) {
+		p.ReloadBin(id)
+	}
+	p.focusCurrentGrid()
+}
+
+// binLabel is like binTitle but also names the excluded bin.
+func (p *PicsortUI) binLabel(id int) string {
+	if id == -1 {
+		return "Excluded"
+	}
+
+	return p.binTitle(id)
+}
+
+// describeHistoryEntry returns a one line description of a sorting operation.
+func (p *PicsortUI) describeHistoryEntry(entry data.HistoryEntry) string {
+	n := len(entry.Changes)
+	var desc string
+	switch entry.Action {
+	case data.HistoryMove:
+		desc = fmt.Sprintf("Moved %d image(s) from %s to %s", n, p.binLabel(entry.SourceID), p.binLabel(entry.DestID))
+	case data.HistoryAdd:
+		desc = fmt.Sprintf("Added %d image(s) to %s", n, p.binLabel(entry.DestID))
+	case data.HistoryExclude:
+		desc = fmt.Sprintf("Excluded %d duplicate image(s)", n)
+	case data.HistoryRemoveBin:
+		name := entry.BinName
+		if name == "" {
+			name = fmt.Sprintf("Bin %d", entry.SourceID)
+		}
+		desc = fmt.Sprintf("Removed %s, %d image(s) went to %s", name, n, p.binLabel(entry.DestID))
+	default:
+		desc = entry.Action
+	}
+
+	if entry.Undone {
+		desc += " (undone)"
+	}
+
+	return fmt.Sprintf("%s  %s", entry.Time.Local().Format("2006-01-02 15:04"), desc)
+}
+
+// historyDialog shows the most recent sorting operations, most recent first.
+func (p *PicsortUI) historyDialog() {
+	entries, err := p.controller.GetHistory()
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+
+	list := widget.NewList(
+		func() int { return len(entries) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(p.describeHistoryEntry(entries[i]))
+		},
+	)
+
+	d := dialog.NewCustom("History", "Close", list, p.win)
+	d.SetOnClosed(p.focusCurrentGrid)
+	d.Resize(fyne.NewSize(600, 400))
+	d.Show()
+}
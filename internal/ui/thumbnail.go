@@ -45,6 +45,11 @@ func (r *thumbnailRenderer) MinSize() fyne.Size {
 
 func (r *thumbnailRenderer) Refresh() {
 	r.thumb.Image = r.thumbnail.Image
+	r.thumb.Resource = nil
+	if r.thumb.Image == nil {
+		// placeholder shown until the image is cached
+		r.thumb.Resource = theme.FileImageIcon()
+	}
 	r.thumb.Refresh()
 	if r.thumbnail.Checked {
 		r.checkIcon.Resource = theme.CheckButtonCheckedIcon()
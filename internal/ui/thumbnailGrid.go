@@ -4,6 +4,7 @@ import (
 	"image"
 	"math"
 	"slices"
+	"strconv"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -16,6 +17,9 @@ type ThumbnailProvider interface {
 	GetThumbnail(path string) image.Image
 	GetImagePaths(bindID int) []string
 	MoveImages(paths []string, sourceID, destID int) error
+	AddImagesToBin(paths []string, destID int) error
+	PrioritizeImages(paths []string)
+	PrefetchImages(paths []string)
 }
 
 type CoreUI interface {
@@ -23,10 +27,20 @@ type CoreUI interface {
 	RefreshTabCount(id int)
 	ShowErrorDialog(err error)
 	UpdatePreview(path string)
+	ZoomImage(path string)
 	OnTypedKey(e *fyne.KeyEvent)
 	OnTypedRune(r rune)
+	BinAt(position int) (int, bool)
+	PickBin(title string, onPicked func(id int))
 }
 
+const (
+	// prioritizeDelay groups the placeholders laid out together into a single request.
+	prioritizeDelay = 50 * time.Millisecond
+	// defaultPageItems is the number of images prioritized when the visible ones are unknown.
+	defaultPageItems = 50
+)
+
 type ThumbnailGridWrap struct {
 	widget.GridWrap
 	id              int
@@ -34,14 +48,23 @@ type ThumbnailGridWrap struct {
 	selectedIDs     []widget.GridWrapItemID
 	previousKey     fyne.KeyName
 	previousKeyAt   time.Time
+	leaderDigits    string
+	leaderAt        time.Time
 	currentID       widget.GridWrapItemID
 	imagePaths      []string
+	// prioritizing is set while the images to cache first are about to be requested
+	prioritizing bool
 
 	dataProvider ThumbnailProvider
 	ui           CoreUI
 }
 
 func (g *ThumbnailGridWrap) TypedKey(key *fyne.KeyEvent) {
+	if g.leaderActive() {
+		g.typedLeaderKey(key)
+		return
+	}
+
 	key = translateKey(key)
 	switch key.Name {
 	case fyne.KeySpace:
@@ -88,27 +111,40 @@ func (g *ThumbnailGridWrap) TypedKey(key *fyne.KeyEvent) {
 	case fyne.KeyEscape:
 		g.unselectAll()
 	case fyne.Key1:
-		g.MoveImages(1)
+		g.moveToPosition(1)
 	case fyne.Key2:
-		g.MoveImages(2)
+		g.moveToPosition(2)
 	case fyne.Key3:
-		g.MoveImages(3)
+		g.moveToPosition(3)
 	case fyne.Key4:
-		g.MoveImages(4)
+		g.moveToPosition(4)
 	case fyne.Key5:
-		g.MoveImages(5)
+		g.moveToPosition(5)
 	case fyne.Key6:
-		g.MoveImages(6)
+		g.moveToPosition(6)
 	case fyne.Key7:
-		g.MoveImages(7)
+		g.moveToPosition(7)
 	case fyne.Key8:
-		g.MoveImages(8)
+		g.moveToPosition(8)
 	case fyne.Key9:
-		g.MoveImages(9)
+		g.moveToPosition(9)
 	case fyne.Key0:
-		g.MoveImages(0)
+		g.moveToPosition(0)
 	case fyne.KeyX:
 		g.MoveImages(-1)
+	case fyne.KeySemicolon:
+		if !shiftPressed() {
+			g.leaderDigits = ""
+			g.leaderAt = time.Now()
+		}
+	case fyne.KeyP:
+		g.ui.PickBin("Move to bin", g.MoveImages)
+	case fyne.KeyA:
+		g.ui.PickBin("Also add to bin", g.AddImages)
+	case fyne.KeyZ, fyne.KeyReturn:
+		if g.currentID >= 0 && g.currentID < len(g.imagePaths) {
+			g.ui.ZoomImage(g.imagePaths[g.currentID])
+		}
 	default:
 		g.ui.OnTypedKey(key)
 	}
@@ -118,6 +154,29 @@ func (g *ThumbnailGridWrap) TypedRune(r rune) {
 	g.ui.OnTypedRune(r)
 }
 
+// leaderActive reports whether the leader key was pressed recently and the grid is
+// waiting for the two digit position of the bin to move the selection to.
+func (g *ThumbnailGridWrap) leaderActive() bool {
+	return !g.leaderAt.IsZero() && time.Since(g.leaderAt) < 2*time.Second
+}
+
+func (g *ThumbnailGridWrap) typedLeaderKey(key *fyne.KeyEvent) {
+	digit := string(key.Name)
+	if len(digit) != 1 || digit[0] < '0' || digit[0] > '9' {
+		g.leaderAt = time.Time{}
+		return
+	}
+
+	g.leaderDigits += digit
+	if len(g.leaderDigits) < 2 {
+		return
+	}
+
+	g.leaderAt = time.Time{}
+	position, _ := strconv.Atoi(g.leaderDigits)
+	g.moveToPosition(position)
+}
+
 func (g *ThumbnailGridWrap) isDoublePress(key *fyne.KeyEvent) bool {
 	if time.Since(g.previousKeyAt) < 500*time.Millisecond {
 		g.previousKey = ""
@@ -150,6 +209,7 @@ func (g *ThumbnailGridWrap) onHighlighted(id widget.GridWrapItemID) {
 	}
 	g.ui.UpdatePreview(g.imagePaths[id])
 	g.currentID = id
+	g.prefetchNeighbors(id)
 
 	if !shiftPressed() {
 		g.selectionAnchor = -1
@@ -174,6 +234,20 @@ func (g *ThumbnailGridWrap) onHighlighted(id widget.GridWrapItemID) {
 	}
 }
 
+// prefetchNeighbors asks for the images around id to be decoded ahead, the ones the next
+// move in any direction highlights.
+func (g *ThumbnailGridWrap) prefetchNeighbors(id widget.GridWrapItemID) {
+	cols := max(g.ColumnCount(), 1)
+	var paths []string
+	for _, neighbor := range []int{id + 1, id - 1, id + cols, id - cols} {
+		if neighbor >= 0 && neighbor < len(g.imagePaths) {
+			paths = append(paths, g.imagePaths[neighbor])
+		}
+	}
+
+	g.dataProvider.PrefetchImages(paths)
+}
+
 func (g *ThumbnailGridWrap) unselectAll() {
 	g.selectedIDs = []widget.GridWrapItemID{}
 	g.selectionAnchor = -1
@@ -206,8 +280,9 @@ func (g *ThumbnailGridWrap) updateItem(i widget.GridWrapItemID, o fyne.CanvasObj
 	path := g.imagePaths[i]
 	imgCheck := o.(*Thumbnail)
 
-	if thumb := g.dataProvider.GetThumbnail(path); thumb != nil {
-		imgCheck.Image = thumb
+	imgCheck.Image = g.dataProvider.GetThumbnail(path)
+	if imgCheck.Image == nil {
+		g.prioritizeVisible()
 	}
 
 	imgCheck.Checked = slices.Contains(g.selectedIDs, i)
@@ -225,6 +300,33 @@ func (g *ThumbnailGridWrap) updateItem(i widget.GridWrapItemID, o fyne.CanvasObj
 	imgCheck.Refresh()
 }
 
+// prioritizeVisible asks for the visible images to be cached first, followed by the next and
+// the previous page so scrolling finds them ready. Placeholders laid out together make a single
+// request.
+func (g *ThumbnailGridWrap) prioritizeVisible() {
+	if g.prioritizing {
+		return
+	}
+	g.prioritizing = true
+
+	time.AfterFunc(prioritizeDelay, func() {
+		fyne.Do(func() {
+			g.prioritizing = false
+			ids := g.visibleItemIDs()
+			first, last := 0, min(len(g.imagePaths), defaultPageItems)
+			if len(ids) > 0 {
+				first, last = int(ids[0]), int(ids[len(ids)-1])+1
+			}
+			page := max(last-first, defaultPageItems)
+
+			paths := slices.Clone(g.imagePaths[first:last])
+			paths = append(paths, g.imagePaths[last:min(last+page, len(g.imagePaths))]...)
+			paths = append(paths, g.imagePaths[max(first-page, 0):first]...)
+			g.dataProvider.PrioritizeImages(paths)
+		})
+	})
+}
+
 func (g *ThumbnailGridWrap) visibleItemIDs() []widget.GridWrapItemID {
 	if g.Length() == 0 {
 		return nil
@@ -297,31 +399,43 @@ func (g *ThumbnailGridWrap) goToMiddle() {
 	}
 }
 
-func (g *ThumbnailGridWrap) MoveImages(destID int) {
+// moveToPosition moves the selected images to the bin shown at a tab position.
+func (g *ThumbnailGridWrap) moveToPosition(position int) {
+	if id, ok := g.ui.BinAt(position); ok {
+		g.MoveImages(id)
+	}
+}
+
+// selectedPaths returns the paths of the selected images, or the highlighted image when
+// nothing is selected, and the item to highlight once they are gone.
+func (g *ThumbnailGridWrap) selectedPaths() ([]string, widget.GridWrapItemID) {
 	if len(g.imagePaths) == 0 {
-		return
+		return nil, 0
 	}
 
-	var nextHighlightID int
-	var toMove []string
 	if len(g.selectedIDs) == 0 {
 		imagePath := g.imagePaths[g.currentID]
 		if imagePath == "" {
-			return
+			return nil, 0
 		}
-		toMove = []string{imagePath}
-		nextHighlightID = g.currentID
+		return []string{imagePath}, g.currentID
 	}
 
-	if len(g.selectedIDs) > 0 {
-		for _, id := range g.selectedIDs {
-			if id < 0 {
-				continue
-			}
-			toMove = append(toMove, g.imagePaths[id])
+	var paths []string
+	for _, id := range g.selectedIDs {
+		if id < 0 {
+			continue
 		}
+		paths = append(paths, g.imagePaths[id])
+	}
 
-		nextHighlightID = slices.Min(g.selectedIDs)
+	return paths, slices.Min(g.selectedIDs)
+}
+
+func (g *ThumbnailGridWrap) MoveImages(destID int) {
+	toMove, nextHighlightID := g.selectedPaths()
+	if len(toMove) == 0 {
+		return
 	}
 
 	g.dataProvider.MoveImages(toMove, g.id, destID)
@@ -330,6 +444,20 @@ func (g *ThumbnailGridWrap) MoveImages(destID int) {
 	g.Highlight(nextHighlightID)
 }
 
+// AddImages adds the selected images to another bin, keeping them in this one.
+func (g *ThumbnailGridWrap) AddImages(destID int) {
+	toAdd, _ := g.selectedPaths()
+	if len(toAdd) == 0 || destID == g.id {
+		return
+	}
+
+	if err := g.dataProvider.AddImagesToBin(toAdd, destID); err != nil {
+		g.ui.ShowErrorDialog(err)
+		return
+	}
+	go g.ui.ReloadBin(destID)
+}
+
 func NewThumbnailGrid(id int, ui CoreUI, d ThumbnailProvider) *ThumbnailGridWrap {
 	grid := &ThumbnailGridWrap{
 		ui:              ui,
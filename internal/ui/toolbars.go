@@ -2,6 +2,7 @@ package ui
 
 import (
 	_ "embed"
+	"fmt"
 	"net/url"
 
 	"fyne.io/fyne/v2"
@@ -21,16 +22,29 @@ func newURLToolbarAction(a fyne.App, icon fyne.Resource, urlStr string) widget.T
 func (p *PicsortUI) setTopBar() {
 	openDataSetButton := widget.NewButton("Open dataset", p.openDataSetDialog)
 	exportButton := widget.NewButton("Export", p.exportDatasetDialog)
-	exportBalanced := widget.NewButton("Balance & Export", p.exportBalancedDatasetDialog)
-	c := newHelpDialogContent()
+	exportSplit := widget.NewButton("Split & Export", p.exportSplitDatasetDialog)
+	p.helpBins = container.NewGridWithColumns(2)
+	c := newHelpDialogContent(p.helpBins)
 	p.helpDialog = dialog.NewCustom("Help", "Close", c, p.win)
 	p.helpDialog.Resize(fyne.NewSize(450, 500))
 	p.helpButton = widget.NewButtonWithIcon("", theme.HelpIcon(), func() {
+		p.refreshHelpBins()
 		p.helpDialog.Show()
 	})
 
-	p.topBar = container.NewBorder(nil, nil, nil, p.helpButton,
-		container.NewHBox(openDataSetButton, exportButton, exportBalanced),
+	p.cacheProgress = widget.NewProgressBar()
+	p.cacheProgress.TextFormatter = func() string {
+		return fmt.Sprintf("caching images %.0f%%", p.cacheProgress.Value*100)
+	}
+	p.cacheProgress.Hide()
+	p.cacheCancel = widget.NewButtonWithIcon("", theme.CancelIcon(), p.cancelCaching)
+	p.cacheCancel.Importance = widget.LowImportance
+	p.cacheCancel.Hide()
+
+	p.topBar = container.NewBorder(nil, nil,
+		container.NewHBox(openDataSetButton, exportButton, exportSplit),
+		p.helpButton,
+		container.NewBorder(nil, nil, nil, p.cacheCancel, p.cacheProgress),
 	)
 }
 
@@ -44,17 +58,35 @@ func (p *PicsortUI) setBottomBar() {
 		p.RemoveBin()
 	})
 
+	p.renameBinButton = widget.NewToolbarAction(theme.DocumentCreateIcon(), func() {
+		p.renameBinDialog()
+	})
+
+	p.historyButton = widget.NewToolbarAction(theme.HistoryIcon(), func() {
+		p.historyDialog()
+	})
+
+	p.duplicateButton = widget.NewToolbarAction(theme.ContentCopyIcon(), func() {
+		p.duplicatesDialog()
+	})
+
 	p.excludedButton = widget.NewToolbarAction(theme.DeleteIcon(), func() {
 		p.toggleExcluded()
 	})
 
 	p.rmBinButton.ToolbarObject().Hide()
+	p.renameBinButton.ToolbarObject().Hide()
+	p.historyButton.ToolbarObject().Hide()
+	p.duplicateButton.ToolbarObject().Hide()
 	p.excludedButton.ToolbarObject().Hide()
 
 	p.bottomBar = widget.NewToolbar(
 		p.excludedButton,
 		p.addBinButton,
 		p.rmBinButton,
+		p.renameBinButton,
+		p.historyButton,
+		p.duplicateButton,
 		widget.NewToolbarSpacer(),
 		newURLToolbarAction(p.app, Icons["logo"], "https://picsort.coolapso.sh"),
 		newURLToolbarAction(p.app, Icons["sponsor"], "https://github.com/sponsors/coolapso"),
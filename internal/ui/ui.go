@@ -1,9 +1,15 @@
 package ui
 
 import (
+	"context"
 	"fmt"
+	"image/color"
 	"log"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -14,10 +20,14 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 	"github.com/coolapso/picsort/internal/controller"
+	"github.com/coolapso/picsort/internal/data"
 )
 
 var Version = "dev"
 
+// cacheUpdateInterval is how often the background caching refreshes the thumbnails being shown.
+const cacheUpdateInterval = 250 * time.Millisecond
+
 type PicsortUI struct {
 	app        fyne.App
 	win        fyne.Window
@@ -26,29 +36,48 @@ type PicsortUI struct {
 	welcomeScreen  *fyne.Container
 	tabs           *container.AppTabs
 	binGrids       map[int]*ThumbnailGridWrap
+	binLayout      []int
 	excludedGrid   *ThumbnailGridWrap
 	progress       *widget.ProgressBar
 	progressValue  binding.Float
 	progressTitle  *widget.Label
 	progressFile   *widget.Label
 	progressDialog dialog.Dialog
-	preview        *canvas.Image
-	previewCard    *widget.Card
-	mainStack      *fyne.Container
-	mainContent    *container.Split
-	topBar         *fyne.Container
-	bottomBar      fyne.Widget
-	addBinButton   widget.ToolbarItem
-	rmBinButton    widget.ToolbarItem
-	excludedButton widget.ToolbarItem
-	helpButton     *widget.Button
-	helpDialog     dialog.Dialog
-	helpVisible    bool
+	progressCancel *widget.Button
+	// cancelOperation cancels the operation shown in the progress dialog, cancelLoad the load of
+	// the open dataset, which keeps caching images after the progress dialog is gone.
+	cancelOperation context.CancelFunc
+	cancelLoad      context.CancelFunc
+	cacheProgress   *widget.ProgressBar
+	cacheCancel     *widget.Button
+	// cacheMut guards cacheUpdatedAt, which throttles the background caching updates.
+	cacheMut        sync.Mutex
+	cacheUpdatedAt  time.Time
+	preview         *canvas.Image
+	previewCard     *widget.Card
+	previewPath     string
+	zoomView        *ZoomView
+	mainStack       *fyne.Container
+	mainContent     *container.Split
+	topBar          *fyne.Container
+	bottomBar       fyne.Widget
+	addBinButton    widget.ToolbarItem
+	rmBinButton     widget.ToolbarItem
+	renameBinButton widget.ToolbarItem
+	historyButton   widget.ToolbarItem
+	duplicateButton widget.ToolbarItem
+	excludedButton  widget.ToolbarItem
+	helpButton      *widget.Button
+	helpDialog      dialog.Dialog
+	helpBins        *fyne.Container
+	helpVisible     bool
 }
 
 func (p *PicsortUI) ShowProgressDialog(msg string) {
 	fyne.Do(func() {
 		p.progressTitle.SetText(msg)
+		p.progressCancel.SetText("Cancel")
+		p.progressCancel.Enable()
 		p.progressDialog.Show()
 		p.progress.Show()
 		_ = p.progressValue.Set(0)
@@ -61,6 +90,46 @@ func (p *PicsortUI) HideProgressDialog() {
 	})
 }
 
+// newOperation returns the context of an operation shown in the progress dialog, cancelled by
+// its Cancel button.
+func (p *PicsortUI) newOperation() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancelOperation = cancel
+	return ctx
+}
+
+// newLoad returns the context of loading the dataset, which also stops caching its images in the
+// background when cancelled. The previous load is cancelled.
+func (p *PicsortUI) newLoad() context.Context {
+	if p.cancelLoad != nil {
+		p.cancelLoad()
+	}
+
+	ctx := p.newOperation()
+	p.cancelLoad = p.cancelOperation
+	return ctx
+}
+
+// cancelProgress cancels the operation shown in the progress dialog, which is hidden once the
+// operation stops.
+func (p *PicsortUI) cancelProgress() {
+	if p.cancelOperation == nil {
+		return
+	}
+
+	p.cancelOperation()
+	p.progressCancel.SetText("Cancelling...")
+	p.progressCancel.Disable()
+}
+
+// cancelCaching stops caching the images of the dataset, the ones not cached yet are cached on
+// the next load.
+func (p *PicsortUI) cancelCaching() {
+	if p.cancelLoad != nil {
+		p.cancelLoad()
+	}
+}
+
 func (p *PicsortUI) toggleHelp() {
 	if p.helpVisible {
 		p.hideHelpDialog()
@@ -72,6 +141,7 @@ func (p *PicsortUI) toggleHelp() {
 
 func (p *PicsortUI) showHelpDialog() {
 	fyne.Do(func() {
+		p.refreshHelpBins()
 		p.helpDialog.Show()
 		p.helpVisible = true
 	})
@@ -87,6 +157,9 @@ func (p *PicsortUI) hideHelpDialog() {
 func (p *PicsortUI) showBottomBarButtons() {
 	p.addBinButton.ToolbarObject().Show()
 	p.rmBinButton.ToolbarObject().Show()
+	p.renameBinButton.ToolbarObject().Show()
+	p.historyButton.ToolbarObject().Show()
+	p.duplicateButton.ToolbarObject().Show()
 	p.excludedButton.ToolbarObject().Show()
 }
 
@@ -97,6 +170,41 @@ func (p *PicsortUI) SetProgress(progress float64, f string) {
 	})
 }
 
+// SetCacheProgress shows the progress of the background caching in the top bar, and refreshes the
+// thumbnails and preview as images get cached. Updates are throttled to a few per second.
+func (p *PicsortUI) SetCacheProgress(progress float64, f string) {
+	done := progress >= 1
+	p.cacheMut.Lock()
+	if !done && time.Since(p.cacheUpdatedAt) < cacheUpdateInterval {
+		p.cacheMut.Unlock()
+		return
+	}
+	p.cacheUpdatedAt = time.Now()
+	p.cacheMut.Unlock()
+
+	fyne.Do(func() {
+		if done {
+			p.cacheProgress.Hide()
+			p.cacheCancel.Hide()
+		} else {
+			p.cacheProgress.SetValue(progress)
+			p.cacheProgress.Show()
+			p.cacheCancel.Show()
+		}
+
+		for _, grid := range p.binGrids {
+			grid.Refresh()
+		}
+		if p.excludedGrid != nil {
+			p.excludedGrid.Refresh()
+		}
+		if p.preview.Image == nil && p.previewPath != "" {
+			p.preview.Image = p.controller.GetPreview(p.previewPath)
+			p.preview.Refresh()
+		}
+	})
+}
+
 func (p *PicsortUI) ShowErrorDialog(err error) {
 	fyne.Do(func() {
 		d := dialog.NewError(err, p.win)
@@ -114,9 +222,8 @@ func (p *PicsortUI) toggleExcluded() {
 	if p.excludedGrid.Visible() {
 		p.excludedGrid.Hide()
 		p.tabs.Show()
-		tabIndex := p.tabs.SelectedIndex()
-		if grid, ok := p.binGrids[tabIndex]; ok {
-			p.win.Canvas().Focus(grid)
+		if id, ok := p.BinAt(p.tabs.SelectedIndex()); ok {
+			p.win.Canvas().Focus(p.binGrids[id])
 		}
 		return
 	}
@@ -135,7 +242,7 @@ func (p *PicsortUI) openDataSetDialog() {
 		if uri == nil {
 			return
 		}
-		go p.controller.LoadDataset(uri.Path())
+		go p.controller.LoadDataset(p.newLoad(), uri.Path())
 	}, p.win)
 	folderDialog.Resize(fyne.NewSize(800, 600))
 	folderDialog.Show()
@@ -150,25 +257,161 @@ func (p *PicsortUI) exportDatasetDialog() {
 		if uri == nil {
 			return
 		}
-		go p.controller.ExportDataset(uri.Path(), false)
+		go p.controller.ExportDataset(p.newOperation(), uri.Path(), controller.ExportOptions{})
 	}, p.win)
 	folderDialog.Resize(fyne.NewSize(800, 600))
 	folderDialog.Show()
 }
 
-func (p *PicsortUI) exportBalancedDatasetDialog() {
-	folderDialog := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+func (p *PicsortUI) exportSplitDatasetDialog() {
+	split, err := p.controller.GetSplitConfig()
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+
+	// the split and seed are only stored once an export is confirmed with them
+	seed, _, err := p.controller.SuggestSplitSeed()
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+
+	formatRatio := func(r float64) string { return strconv.FormatFloat(r, 'f', -1, 64) }
+	train := widget.NewEntry()
+	train.SetText(formatRatio(split.Train))
+	validation := widget.NewEntry()
+	validation.SetText(formatRatio(split.Validation))
+	test := widget.NewEntry()
+	test.SetText(formatRatio(split.Test))
+	folds := widget.NewEntry()
+	folds.SetText(strconv.Itoa(split.Folds))
+	remainder := widget.NewSelect([]string{string(data.RemainderDistribute), string(data.RemainderTrain)}, nil)
+	remainder.SetSelected(string(split.Remainder))
+	summary := widget.NewLabel(split.String())
+	seedEntry := widget.NewEntry()
+	seedEntry.SetText(strconv.FormatUint(seed, 10))
+	pin := widget.NewCheck("Keep images in the split they are exported to", nil)
+	oversample := widget.NewCheck("Duplicate training images of the smaller bins", nil)
+	classWeights := widget.NewCheck("Write class_weights.json", nil)
+	keepClusters := widget.NewCheck("Keep near-duplicates in the same split", nil)
+	mode := widget.NewRadioGroup([]string{"Balanced", "Stratified"}, func(selected string) {
+		if selected == "Stratified" {
+			oversample.Enable()
+			classWeights.Enable()
+			return
+		}
+		oversample.Disable()
+		classWeights.Disable()
+	})
+	mode.Horizontal = true
+	mode.Required = true
+	mode.SetSelected("Balanced")
+
+	readSplit := func() (data.SplitConfig, error) {
+		var s data.SplitConfig
+		var err error
+		if s.Train, err = strconv.ParseFloat(train.Text, 64); err != nil {
+			return s, fmt.Errorf("invalid training ratio: %v", err)
+		}
+		if s.Validation, err = strconv.ParseFloat(validation.Text, 64); err != nil {
+			return s, fmt.Errorf("invalid validation ratio: %v", err)
+		}
+		if s.Test, err = strconv.ParseFloat(test.Text, 64); err != nil {
+			return s, fmt.Errorf("invalid test ratio: %v", err)
+		}
+		if s.Folds, err = strconv.Atoi(folds.Text); err != nil {
+			return s, fmt.Errorf("invalid number of folds: %v", err)
+		}
+		s.Remainder = data.RemainderPolicy(remainder.Selected)
+
+		return s, s.Validate()
+	}
+
+	onChanged := func(string) {
+		if s, err := readSplit(); err == nil {
+			summary.SetText(s.String())
+		}
+	}
+	train.OnChanged = onChanged
+	validation.OnChanged = onChanged
+	test.OnChanged = onChanged
+	folds.OnChanged = onChanged
+	remainder.OnChanged = onChanged
+
+	modeItem := widget.NewFormItem("Mode", mode)
+	modeItem.HintText = "balanced downsamples every bin to the smallest one"
+	foldsItem := widget.NewFormItem("Folds", folds)
+	foldsItem.HintText = "0 to disable, k-fold ignores the validation ratio"
+	remainderItem := widget.NewFormItem("Remainder", remainder)
+	remainderItem.HintText = "where images left over by rounding go"
+	seedItem := widget.NewFormItem("Seed", seedEntry)
+	seedItem.HintText = "the same seed always produces the same split"
+
+	items := []*widget.FormItem{
+		modeItem,
+		widget.NewFormItem("Training", train),
+		widget.NewFormItem("Validation", validation),
+		widget.NewFormItem("Test", test),
+		foldsItem,
+		remainderItem,
+		widget.NewFormItem("Split", summary),
+		seedItem,
+		widget.NewFormItem("Pin", pin),
+		widget.NewFormItem("Oversample", oversample),
+		widget.NewFormItem("Weights", classWeights),
+		widget.NewFormItem("Clusters", keepClusters),
+	}
+
+	form := dialog.NewForm("Split & Export", "Export", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+
+		s, err := readSplit()
 		if err != nil {
-			log.Println("Error opening folder dialog:", err)
+			p.ShowErrorDialog(err)
 			return
 		}
-		if uri == nil {
+		seed, err := strconv.ParseUint(seedEntry.Text, 10, 64)
+		if err != nil {
+			p.ShowErrorDialog(fmt.Errorf("invalid seed: %v", err))
 			return
 		}
-		go p.controller.ExportDataset(uri.Path(), true)
+		opts := controller.ExportOptions{
+			Mode:         controller.ExportBalanced,
+			PinSplits:    pin.Checked,
+			Oversample:   oversample.Checked,
+			ClassWeights: classWeights.Checked,
+			KeepClusters: keepClusters.Checked,
+		}
+		if mode.Selected == "Stratified" {
+			opts.Mode = controller.ExportStratified
+		}
+
+		folderDialog := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil {
+				log.Println("Error opening folder dialog:", err)
+				return
+			}
+			if uri == nil {
+				return
+			}
+			if err := p.controller.SetSplitConfig(s); err != nil {
+				p.ShowErrorDialog(err)
+				return
+			}
+			if err := p.controller.SetSplitSeed(seed); err != nil {
+				p.ShowErrorDialog(err)
+				return
+			}
+			go p.controller.ExportDataset(p.newOperation(), uri.Path(), opts)
+		}, p.win)
+		folderDialog.Resize(fyne.NewSize(800, 600))
+		folderDialog.Show()
 	}, p.win)
-	folderDialog.Resize(fyne.NewSize(800, 600))
-	folderDialog.Show()
+	form.Resize(fyne.NewSize(550, 600))
+	form.Show()
 }
 
 func (p *PicsortUI) ReloadAll() {
@@ -200,46 +443,169 @@ func (p *PicsortUI) onTabSelected(tab *container.TabItem) {
 	}
 }
 
-func (p *PicsortUI) GoToTab(id int) {
+func (p *PicsortUI) GoToTab(position int) {
 	fyne.Do(func() {
-		if id < len(p.tabs.Items) {
-			p.tabs.SelectIndex(id)
-			if p.tabs.SelectedIndex() == id {
+		if id, ok := p.BinAt(position); ok {
+			p.tabs.SelectIndex(position)
+			if p.tabs.SelectedIndex() == position {
 				p.win.Canvas().Focus(p.binGrids[id])
 			}
 		}
 	})
 }
 
+// focusCurrentGrid gives the keyboard focus back to the grid being shown.
+func (p *PicsortUI) focusCurrentGrid() {
+	if p.excludedGrid != nil && p.excludedGrid.Visible() {
+		p.win.Canvas().Focus(p.excludedGrid)
+		return
+	}
+	p.GoToTab(p.tabs.SelectedIndex())
+}
+
+// PickBin shows a popup to pick a bin by fuzzy matching its position or name, which
+// is how bins beyond the first ten, that have no key of their own, are reached.
+func (p *PicsortUI) PickBin(title string, onPicked func(id int)) {
+	type binOption struct {
+		id    int
+		label string
+	}
+
+	var options []binOption
+	for position, id := range p.binLayout {
+		options = append(options, binOption{id: id, label: fmt.Sprintf("%d  %s", position, p.binTitle(id))})
+	}
+	matches := options
+
+	list := widget.NewList(
+		func() int { return len(matches) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(matches[i].label) },
+	)
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("bin number or name")
+
+	var d dialog.Dialog
+	pick := func(i int) {
+		if i < 0 || i >= len(matches) {
+			return
+		}
+		onPicked(matches[i].id)
+		d.Hide()
+	}
+
+	entry.OnChanged = func(text string) {
+		matches = nil
+		for _, option := range options {
+			if fuzzyMatch(text, option.label) {
+				matches = append(matches, option)
+			}
+		}
+		list.UnselectAll()
+		list.Refresh()
+	}
+	entry.OnSubmitted = func(string) { pick(0) }
+	list.OnSelected = pick
+
+	sizer := canvas.NewRectangle(color.Transparent)
+	sizer.SetMinSize(fyne.NewSize(300, 300))
+	d = dialog.NewCustom(title, "Cancel", container.NewBorder(entry, nil, nil, nil, container.NewStack(sizer, list)), p.win)
+	d.SetOnClosed(p.focusCurrentGrid)
+	d.Show()
+	p.win.Canvas().Focus(entry)
+}
+
+// BinAt returns the id of the bin shown at a tab position.
+func (p *PicsortUI) BinAt(position int) (int, bool) {
+	if position < 0 || position >= len(p.binLayout) {
+		return 0, false
+	}
+
+	return p.binLayout[position], true
+}
+
 func (p *PicsortUI) RefreshTabCount(id int) {
 	fyne.Do(func() {
 		p.setTabTitle(id)
 	})
 }
 
+// binTitle returns the name shown for a bin, its name if it has one or its number otherwise.
+func (p *PicsortUI) binTitle(id int) string {
+	if id == 0 {
+		return "To Sort"
+	}
+	if name := p.controller.GetBinName(id); name != "" {
+		return name
+	}
+
+	return fmt.Sprintf("Bin %d", id)
+}
+
 func (p *PicsortUI) setTabTitle(id int) {
-	if id < 0 {
+	position := slices.Index(p.binLayout, id)
+	if id < 0 || position < 0 {
 		return
 	}
-	tabTitle := fmt.Sprintf("Bin %d", id)
-	if id == 0 {
-		tabTitle = "To Sort"
+	tabTitle := p.binTitle(id)
+	if p.binGrids[id].itemCount() > 0 {
+		tabTitle = fmt.Sprintf("%s (%d)", tabTitle, p.binGrids[id].itemCount())
 	}
+	p.tabs.Items[position].Text = tabTitle
+	p.tabs.Refresh()
+}
 
-	if p.binGrids[id].itemCount() > 0 {
-		tabTitle = fmt.Sprintf("Bin %d (%d)", id, p.binGrids[id].itemCount())
-		if id == 0 {
-			tabTitle = fmt.Sprintf("To Sort (%d)", p.binGrids[id].itemCount())
+func (p *PicsortUI) renameBinDialog() {
+	id, ok := p.BinAt(p.tabs.SelectedIndex())
+	if !ok || id <= 0 {
+		return
+	}
+
+	entry := widget.NewEntry()
+	entry.SetText(p.controller.GetBinName(id))
+	entry.SetPlaceHolder(fmt.Sprintf("Bin %d", id))
+	item := widget.NewFormItem("Name", entry)
+	item.HintText = "used as the tab title and as the folder name on exports"
+
+	d := dialog.NewForm(fmt.Sprintf("Rename bin %d", id), "Rename", "Cancel", []*widget.FormItem{item}, func(confirmed bool) {
+		if confirmed {
+			if err := p.controller.SetBinName(id, entry.Text); err != nil {
+				p.ShowErrorDialog(err)
+				return
+			}
+			p.setTabTitle(id)
 		}
+		if grid, ok := p.binGrids[id]; ok {
+			p.win.Canvas().Focus(grid)
+		}
+	}, p.win)
+	d.Resize(fyne.NewSize(400, 150))
+	d.Show()
+	p.win.Canvas().Focus(entry)
+}
+
+// refreshHelpBins lists the bins and their names in the help dialog.
+func (p *PicsortUI) refreshHelpBins() {
+	p.helpBins.RemoveAll()
+	for position, id := range p.binLayout {
+		key := fmt.Sprint(position)
+		if position > 9 {
+			key = fmt.Sprintf(";%02d", position)
+		}
+		keyLabel := widget.NewLabel(key)
+		keyLabel.TextStyle.Bold = true
+		p.helpBins.Add(keyLabel)
+		p.helpBins.Add(widget.NewLabel(p.binTitle(id)))
 	}
-	p.tabs.Items[id].Text = tabTitle
-	p.tabs.Refresh()
+	p.helpBins.Refresh()
 }
 
 func (p *PicsortUI) GetWindow() fyne.Window { return p.win }
 
 func (p *PicsortUI) UpdatePreview(path string) {
 	fyne.Do(func() {
+		p.resetZoom()
+		p.previewPath = path
 		i := p.controller.GetPreview(path)
 		p.preview.Image = i
 		p.preview.Refresh()
@@ -248,34 +614,114 @@ func (p *PicsortUI) UpdatePreview(path string) {
 }
 
 func (p *PicsortUI) initBins() {
-	for i := 0; i <= 5; i++ {
-		p.NewBin()
-	}
+	p.loadBinLayout()
 	p.excludedGrid = NewThumbnailGrid(-1, p, p.controller)
 	p.excludedGrid.Hide()
 }
 
+// loadBinLayout rebuilds the bin tabs following the layout stored in the dataset.
+func (p *PicsortUI) loadBinLayout() {
+	layout, err := p.controller.GetBinLayout()
+	if err != nil {
+		p.ShowErrorDialog(err)
+	}
+
+	p.binGrids = make(map[int]*ThumbnailGridWrap)
+	p.binLayout = nil
+	p.tabs.SetItems(nil)
+	for _, id := range layout {
+		p.addBin(id)
+	}
+}
+
+func (p *PicsortUI) saveBinLayout() {
+	if err := p.controller.SetBinLayout(p.binLayout); err != nil {
+		log.Println("failed to save bin layout:", err)
+	}
+}
+
+func (p *PicsortUI) addBin(id int) {
+	binGrid := NewThumbnailGrid(id, p, p.controller)
+	p.binGrids[id] = binGrid
+	p.binLayout = append(p.binLayout, id)
+	p.tabs.Append(container.NewTabItem("", binGrid))
+	p.setTabTitle(id)
+}
+
 func (p *PicsortUI) NewBin() {
-	if len(p.binGrids) <= 9 {
-		binCount := len(p.binGrids)
-		binGrid := NewThumbnailGrid(binCount, p, p.controller)
-		p.binGrids[binCount] = binGrid
-		newTab := container.NewTabItem("", p.binGrids[binCount])
-		p.tabs.Append(newTab)
-		p.setTabTitle(binCount)
+	id, err := p.controller.NewBinID(p.binLayout)
+	if err != nil {
+		p.ShowErrorDialog(err)
+		return
 	}
+
+	p.addBin(id)
+	p.saveBinLayout()
 }
 
+// RemoveBin removes the last bin, asking where its images should go if it has any.
 func (p *PicsortUI) RemoveBin() {
-	if len(p.binGrids) > 1 {
-		idToRemove := len(p.binGrids) - 1
-		delete(p.binGrids, idToRemove)
-		p.tabs.Remove(p.tabs.Items[idToRemove])
+	if len(p.binLayout) <= 1 {
+		return
+	}
+
+	id := p.binLayout[len(p.binLayout)-1]
+	if p.binGrids[id].itemCount() == 0 {
+		p.removeBin(id, 0)
+		return
+	}
+
+	options := []string{"Move back to To Sort"}
+	destinations := []int{0}
+	for _, binID := range p.binLayout[1 : len(p.binLayout)-1] {
+		options = append(options, fmt.Sprintf("Merge into %s", p.binTitle(binID)))
+		destinations = append(destinations, binID)
 	}
+	options = append(options, "Exclude")
+	destinations = append(destinations, -1)
+
+	choice := widget.NewRadioGroup(options, nil)
+	choice.Required = true
+	choice.SetSelected(options[0])
+	message := widget.NewLabel(fmt.Sprintf("%s still has %d images, what should be done with them?", p.binTitle(id), p.binGrids[id].itemCount()))
+
+	d := dialog.NewCustomConfirm("Remove bin", "Remove", "Cancel", container.NewVBox(message, choice), func(confirmed bool) {
+		if confirmed {
+			p.removeBin(id, destinations[slices.Index(options, choice.Selected)])
+		}
+		p.GoToTab(p.tabs.SelectedIndex())
+	}, p.win)
+	d.Show()
 }
 
-func (p *PicsortUI) GetBinCount() int {
-	return len(p.binGrids)
+func (p *PicsortUI) removeBin(id, destID int) {
+	if err := p.controller.RemoveBin(id, destID); err != nil {
+		p.ShowErrorDialog(err)
+		return
+	}
+
+	position := slices.Index(p.binLayout, id)
+	delete(p.binGrids, id)
+	p.binLayout = slices.Delete(p.binLayout, position, position+1)
+	p.tabs.RemoveIndex(position)
+	p.saveBinLayout()
+	p.ReloadBin(destID)
+}
+
+// moveBin moves the selected bin tab by offset positions, the To Sort bin always stays first.
+func (p *PicsortUI) moveBin(offset int) {
+	from := p.tabs.SelectedIndex()
+	to := from + offset
+	if from <= 0 || to <= 0 || to >= len(p.binLayout) {
+		return
+	}
+
+	p.binLayout[from], p.binLayout[to] = p.binLayout[to], p.binLayout[from]
+	items := p.tabs.Items
+	items[from], items[to] = items[to], items[from]
+	p.tabs.SetItems(items)
+	p.tabs.SelectIndex(to)
+	p.saveBinLayout()
 }
 
 func (p *PicsortUI) setGlobalKeyBinds() {
@@ -316,6 +762,58 @@ func (p *PicsortUI) setGlobalKeyBinds() {
 		p.RemoveBin()
 	})
 
+	moveBinLeft := &desktop.CustomShortcut{KeyName: fyne.KeyH, Modifier: fyne.KeyModifierAlt}
+	p.win.Canvas().AddShortcut(moveBinLeft, func(s fyne.Shortcut) {
+		p.moveBin(-1)
+	})
+
+	moveBinRight := &desktop.CustomShortcut{KeyName: fyne.KeyL, Modifier: fyne.KeyModifierAlt}
+	p.win.Canvas().AddShortcut(moveBinRight, func(s fyne.Shortcut) {
+		p.moveBin(1)
+	})
+
+	goToBin := &desktop.CustomShortcut{KeyName: fyne.KeyG, Modifier: fyne.KeyModifierControl}
+	p.win.Canvas().AddShortcut(goToBin, func(s fyne.Shortcut) {
+		p.PickBin("Go to bin", func(id int) {
+			p.GoToTab(slices.Index(p.binLayout, id))
+		})
+	})
+
+	renameBin := &desktop.CustomShortcut{KeyName: fyne.KeyR, Modifier: fyne.KeyModifierControl}
+	p.win.Canvas().AddShortcut(renameBin, func(s fyne.Shortcut) {
+		p.renameBinDialog()
+	})
+
+	undo := &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierControl}
+	p.win.Canvas().AddShortcut(undo, func(s fyne.Shortcut) {
+		p.undo()
+	})
+
+	redo := &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift}
+	p.win.Canvas().AddShortcut(redo, func(s fyne.Shortcut) {
+		p.redo()
+	})
+
+	history := &desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierAlt}
+	p.win.Canvas().AddShortcut(history, func(s fyne.Shortcut) {
+		p.historyDialog()
+	})
+
+	duplicates := &desktop.CustomShortcut{KeyName: fyne.KeyD, Modifier: fyne.KeyModifierAlt}
+	p.win.Canvas().AddShortcut(duplicates, func(s fyne.Shortcut) {
+		p.duplicatesDialog()
+	})
+
+	nearDuplicates := &desktop.CustomShortcut{KeyName: fyne.KeyN, Modifier: fyne.KeyModifierAlt}
+	p.win.Canvas().AddShortcut(nearDuplicates, func(s fyne.Shortcut) {
+		p.nearDuplicatesDialog()
+	})
+
+	cache := &desktop.CustomShortcut{KeyName: fyne.KeyC, Modifier: fyne.KeyModifierAlt}
+	p.win.Canvas().AddShortcut(cache, func(s fyne.Shortcut) {
+		p.cacheDialog()
+	})
+
 	ctrlL := &desktop.CustomShortcut{KeyName: fyne.KeyL, Modifier: fyne.KeyModifierControl}
 	p.win.Canvas().AddShortcut(ctrlL, func(s fyne.Shortcut) {
 		offset := p.mainContent.Offset
@@ -355,7 +853,12 @@ func (p *PicsortUI) OnTypedRune(r rune) {
 }
 
 func (p *PicsortUI) LoadContent() {
+	if err := p.controller.WatchDataset(); err != nil {
+		log.Println("could not watch dataset for changes:", err)
+	}
+
 	fyne.Do(func() {
+		p.loadBinLayout()
 		p.ReloadAll()
 		p.HideProgressDialog()
 		p.mainContent.Show()
@@ -376,6 +879,7 @@ func New(a fyne.App, w fyne.Window) {
 		binGrids:      make(map[int]*ThumbnailGridWrap),
 	}
 	p.controller = controller.New(p)
+	p.controller.SetExternalCache(a.Preferences().Bool(externalCachePref))
 	p.setTopBar()
 	p.setBottomBar()
 	p.tabs = container.NewAppTabs()
@@ -384,10 +888,12 @@ func New(a fyne.App, w fyne.Window) {
 	p.setGlobalKeyBinds()
 	p.initBins()
 
+	p.progressCancel = widget.NewButton("Cancel", p.cancelProgress)
 	progressContent := container.NewVBox(
 		p.progressTitle,
 		p.progress,
 		p.progressFile,
+		container.NewCenter(p.progressCancel),
 	)
 	p.progressDialog = dialog.NewCustomWithoutButtons(
 		"Preparing dataset...",
@@ -8,6 +8,8 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
+	"unicode/utf8"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
@@ -62,6 +64,21 @@ func shiftPressed() bool {
 	return fyne.CurrentApp().Driver().(desktop.Driver).CurrentKeyModifiers() == 1
 }
 
+// fuzzyMatch reports whether all characters of pattern appear in s in the same order,
+// ignoring case.
+func fuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, r)
+		if i == -1 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+
+	return true
+}
+
 func translateKey(key *fyne.KeyEvent) *fyne.KeyEvent {
 	translatedKey := *key
 	switch key.Name {
@@ -114,7 +131,7 @@ func newHelpSection(shortcuts map[string]string) *fyne.Container {
 	return grid
 }
 
-func newHelpDialogContent() fyne.CanvasObject {
+func newHelpDialogContent(bins *fyne.Container) fyne.CanvasObject {
 	ghLink, err := url.Parse("https://github.com/coolapso/picsort")
 	if err != nil {
 		log.Println("Error parsing URL for help dialog:", err)
@@ -123,14 +140,23 @@ func newHelpDialogContent() fyne.CanvasObject {
 	link.Alignment = fyne.TextAlignCenter
 
 	globalShortcuts := map[string]string{
-		"?, F1":    "Toggle help dialog",
-		"Ctrl+O":   "Open dataset folder",
-		"Ctrl+E":   "Export dataset",
-		"Ctrl+T":   "Add a new bin",
-		"Ctrl+W":   "Remove the last bin",
-		"Ctrl+0-9": "Switch to the corresponding bin tab",
-		"Ctrl+H/L": "just preview panel size",
-		"Alt+X":    "Toggle exluded images view",
+		"?, F1":        "Toggle help dialog",
+		"Ctrl+O":       "Open dataset folder",
+		"Ctrl+E":       "Export dataset",
+		"Ctrl+T":       "Add a new bin",
+		"Ctrl+W":       "Remove the last bin",
+		"Ctrl+R":       "Rename the current bin",
+		"Alt+H/L":      "Move the current bin tab left / right",
+		"Ctrl+Z":       "Undo the last sorting operation",
+		"Ctrl+Shift+Z": "Redo the last undone operation",
+		"Alt+Z":        "Show the sorting history",
+		"Alt+D":        "Show duplicate images",
+		"Alt+N":        "Show near-duplicate images",
+		"Alt+C":        "Show the cache size, location and settings",
+		"Ctrl+0-9":     "Switch to the corresponding bin tab",
+		"Ctrl+G":       "Pick a bin tab to switch to",
+		"Ctrl+H/L":     "just preview panel size",
+		"Alt+X":        "Toggle exluded images view",
 	}
 
 	movementShortcuts := map[string]string{
@@ -151,13 +177,28 @@ func newHelpDialogContent() fyne.CanvasObject {
 		"Shift + H,J,K,L / Arrow Keys": "Select multiple images",
 		"Escape":                       "Unselect all selected images",
 		"0 - 9":                        "Move selected image(s) to bin",
+		"; + two digits":               "Move selected image(s) to bin 10 and above",
+		"P":                            "Pick a bin to move selected image(s) to",
+		"A":                            "Pick a bin to also add selected image(s) to",
 		"x":                            "Exclude selected image(s)",
 	}
 
+	zoomShortcuts := map[string]string{
+		"Z, Enter":             "Zoom the current image at full resolution",
+		"H,J,K,L / Arrow Keys": "Pan the zoomed image",
+		"I, +":                 "Zoom in",
+		"O, -":                 "Zoom out",
+		"1":                    "Show the image pixel for pixel",
+		"F, 0":                 "Toggle between fitting the image and the last zoom",
+		"Escape, Q, Z":         "Go back to the preview",
+	}
+
 	tabs := container.NewAppTabs(
 		container.NewTabItem("Global", container.NewScroll(newHelpSection(globalShortcuts))),
 		container.NewTabItem("Movement", container.NewScroll(newHelpSection(movementShortcuts))),
 		container.NewTabItem("Selection", container.NewScroll(newHelpSection(selectionShortcuts))),
+		container.NewTabItem("Zoom", container.NewScroll(newHelpSection(zoomShortcuts))),
+		container.NewTabItem("Bins", container.NewScroll(bins)),
 	)
 
 	moreDetailsText := widget.NewLabel("Not what you're looking for?")
@@ -0,0 +1,313 @@
+package ui
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	zoomStep = 1.25
+	maxZoom  = 32.0
+	// panStep is the fraction of the view panned by each key press.
+	panStep = 0.1
+)
+
+// ZoomView shows an image at full resolution, fitted to the view or zoomed in and panned
+// around with vim style keys. Zoom is the number of screen pixels each image pixel takes,
+// so a zoom of 1 shows the image pixel for pixel.
+type ZoomView struct {
+	widget.BaseWidget
+	Image   image.Image
+	Fit     bool
+	Zoom    float64
+	OnZoom  func(percent int)
+	OnClose func()
+
+	// center is the image pixel shown in the middle of the view
+	center fyne.Position
+}
+
+// NewZoomView returns a view of img fitted to its size.
+func NewZoomView(img image.Image, onZoom func(percent int), onClose func()) *ZoomView {
+	z := &ZoomView{
+		Image:   subImager(img),
+		Fit:     true,
+		OnZoom:  onZoom,
+		OnClose: onClose,
+	}
+	bounds := z.Image.Bounds()
+	z.center = fyne.NewPos(float32(bounds.Min.X)+float32(bounds.Dx())/2, float32(bounds.Min.Y)+float32(bounds.Dy())/2)
+	z.ExtendBaseWidget(z)
+	return z
+}
+
+// subImager returns img if parts of it can be cropped without copying, or a copy that can.
+func subImager(img image.Image) image.Image {
+	if _, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return img
+	}
+
+	rgba := image.NewRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	return rgba
+}
+
+func (z *ZoomView) CreateRenderer() fyne.WidgetRenderer {
+	r := &zoomViewRenderer{
+		view:  z,
+		image: canvas.NewImageFromImage(nil),
+	}
+	r.image.FillMode = canvas.ImageFillStretch
+	return r
+}
+
+// canvasScale returns how many screen pixels a fyne unit takes.
+func (z *ZoomView) canvasScale() float32 {
+	if c := fyne.CurrentApp().Driver().CanvasForObject(z); c != nil {
+		return c.Scale()
+	}
+
+	return 1
+}
+
+// fitZoom returns the zoom at which the whole image fits in the view.
+func (z *ZoomView) fitZoom() float64 {
+	size, bounds := z.Size(), z.Image.Bounds()
+	if bounds.Empty() || size.IsZero() {
+		return 1
+	}
+
+	scale := float64(z.canvasScale())
+	return min(float64(size.Width)*scale/float64(bounds.Dx()), float64(size.Height)*scale/float64(bounds.Dy()))
+}
+
+// currentZoom returns the zoom the image is shown at.
+func (z *ZoomView) currentZoom() float64 {
+	if z.Fit {
+		return z.fitZoom()
+	}
+
+	return z.Zoom
+}
+
+// SetZoom shows the image at zoom, keeping the same pixel in the middle of the view.
+func (z *ZoomView) SetZoom(zoom float64) {
+	z.Zoom = max(min(zoom, maxZoom), min(z.fitZoom(), 1))
+	z.Fit = false
+	z.changed()
+}
+
+// ToggleFit switches between fitting the whole image in the view and the last zoom.
+func (z *ZoomView) ToggleFit() {
+	if z.Zoom == 0 {
+		z.Zoom = 1
+	}
+	z.Fit = !z.Fit
+	z.changed()
+}
+
+// Pan moves the view by a fraction of its size, dx and dy are usually -1, 0 or 1.
+func (z *ZoomView) Pan(dx, dy float32) {
+	size := z.Size()
+	zoom := float32(z.currentZoom()) / z.canvasScale()
+	z.center.X += dx * panStep * size.Width / zoom
+	z.center.Y += dy * panStep * size.Height / zoom
+	z.Refresh()
+}
+
+func (z *ZoomView) changed() {
+	if z.OnZoom != nil {
+		z.OnZoom(int(math.Round(z.currentZoom() * 100)))
+	}
+	z.Refresh()
+}
+
+func (z *ZoomView) TypedKey(key *fyne.KeyEvent) {
+	switch translateKey(key).Name {
+	case fyne.KeyLeft:
+		z.Pan(-1, 0)
+	case fyne.KeyRight:
+		z.Pan(1, 0)
+	case fyne.KeyUp:
+		z.Pan(0, -1)
+	case fyne.KeyDown:
+		z.Pan(0, 1)
+	case fyne.KeyI:
+		z.SetZoom(z.currentZoom() * zoomStep)
+	case fyne.KeyO:
+		z.SetZoom(z.currentZoom() / zoomStep)
+	case fyne.Key1:
+		z.SetZoom(1)
+	case fyne.KeyF, fyne.Key0:
+		z.ToggleFit()
+	case fyne.KeyEscape, fyne.KeyQ, fyne.KeyZ:
+		if z.OnClose != nil {
+			z.OnClose()
+		}
+	}
+}
+
+func (z *ZoomView) TypedRune(r rune) {
+	switch r {
+	case '+', '=':
+		z.SetZoom(z.currentZoom() * zoomStep)
+	case '-':
+		z.SetZoom(z.currentZoom() / zoomStep)
+	}
+}
+
+func (z *ZoomView) FocusGained() {}
+
+func (z *ZoomView) FocusLost() {}
+
+func (z *ZoomView) Tapped(*fyne.PointEvent) {
+	if c := fyne.CurrentApp().Driver().CanvasForObject(z); c != nil {
+		c.Focus(z)
+	}
+}
+
+// Scrolled zooms in and out with the mouse wheel.
+func (z *ZoomView) Scrolled(ev *fyne.ScrollEvent) {
+	switch {
+	case ev.Scrolled.DY > 0:
+		z.SetZoom(z.currentZoom() * zoomStep)
+	case ev.Scrolled.DY < 0:
+		z.SetZoom(z.currentZoom() / zoomStep)
+	}
+}
+
+// Dragged pans the image along with the mouse.
+func (z *ZoomView) Dragged(ev *fyne.DragEvent) {
+	zoom := float32(z.currentZoom()) / z.canvasScale()
+	z.center.X -= ev.Dragged.DX / zoom
+	z.center.Y -= ev.Dragged.DY / zoom
+	z.Refresh()
+}
+
+func (z *ZoomView) DragEnd() {}
+
+type zoomViewRenderer struct {
+	view  *ZoomView
+	image *canvas.Image
+}
+
+// Layout crops the part of the image visible at the current zoom and stretches it over the
+// view, so only the visible pixels are ever scaled.
+func (r *zoomViewRenderer) Layout(size fyne.Size) {
+	z := r.view
+	bounds := z.Image.Bounds()
+	zoom := float32(z.currentZoom()) / z.canvasScale()
+	if bounds.Empty() || size.IsZero() || zoom <= 0 {
+		r.image.Hide()
+		return
+	}
+
+	// keep the image in the view, centered along the sides it is smaller than the view in
+	visible := fyne.NewSize(size.Width/zoom, size.Height/zoom)
+	z.center.X = clampCenter(z.center.X, visible.Width, float32(bounds.Min.X), float32(bounds.Max.X))
+	z.center.Y = clampCenter(z.center.Y, visible.Height, float32(bounds.Min.Y), float32(bounds.Max.Y))
+	origin := fyne.NewPos(z.center.X-visible.Width/2, z.center.Y-visible.Height/2)
+
+	crop := image.Rect(
+		int(math.Floor(float64(origin.X))), int(math.Floor(float64(origin.Y))),
+		int(math.Ceil(float64(origin.X+visible.Width))), int(math.Ceil(float64(origin.Y+visible.Height))),
+	).Intersect(bounds)
+	if crop.Empty() {
+		r.image.Hide()
+		return
+	}
+
+	r.image.Image = z.Image.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(crop)
+	r.image.ScaleMode = canvas.ImageScaleSmooth
+	if z.currentZoom() >= 1 {
+		// zoomed in pixels are shown as sharp squares to judge fine detail
+		r.image.ScaleMode = canvas.ImageScalePixels
+	}
+	r.image.Move(fyne.NewPos((float32(crop.Min.X)-origin.X)*zoom, (float32(crop.Min.Y)-origin.Y)*zoom))
+	r.image.Resize(fyne.NewSize(float32(crop.Dx())*zoom, float32(crop.Dy())*zoom))
+	r.image.Show()
+	r.image.Refresh()
+}
+
+// clampCenter keeps center where the visible length shows as much of start to end as possible.
+func clampCenter(center, visible, start, end float32) float32 {
+	if visible >= end-start {
+		return (start + end) / 2
+	}
+
+	return max(start+visible/2, min(center, end-visible/2))
+}
+
+func (r *zoomViewRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(100, 100)
+}
+
+func (r *zoomViewRenderer) Refresh() {
+	r.Layout(r.view.Size())
+}
+
+func (r *zoomViewRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.image}
+}
+
+func (r *zoomViewRenderer) Destroy() {}
+
+// zoomTitle returns the preview subtitle of a zoomed image.
+func zoomTitle(path string, percent int) string {
+	return fmt.Sprintf("%s (%d%%)", filepath.Base(path), percent)
+}
+
+// ZoomImage replaces the preview with the original image at path at full resolution, the keys
+// then zoom and pan it until it is closed.
+func (p *PicsortUI) ZoomImage(path string) {
+	p.previewCard.SetSubTitle(filepath.Base(path) + " (loading...)")
+	go func() {
+		img, err := p.controller.GetOriginal(path)
+		fyne.Do(func() {
+			// the selection moved on while the image was loading
+			if p.previewPath != path {
+				return
+			}
+			if err != nil {
+				p.previewCard.SetSubTitle(filepath.Base(path))
+				p.ShowErrorDialog(err)
+				return
+			}
+
+			p.zoomView = NewZoomView(img, func(percent int) {
+				p.previewCard.SetSubTitle(zoomTitle(path, percent))
+			}, p.closeZoom)
+			p.previewCard.SetContent(p.zoomView)
+			p.previewCard.SetSubTitle(zoomTitle(path, int(math.Round(p.zoomView.fitZoom()*100))))
+			p.win.Canvas().Focus(p.zoomView)
+		})
+	}()
+}
+
+// closeZoom goes back to the cached preview and the image grid.
+func (p *PicsortUI) closeZoom() {
+	p.resetZoom()
+	p.focusCurrentGrid()
+}
+
+// resetZoom shows the cached preview again if an image was zoomed.
+func (p *PicsortUI) resetZoom() {
+	if p.zoomView == nil {
+		return
+	}
+
+	p.zoomView = nil
+	p.previewCard.SetContent(p.preview)
+	p.previewCard.SetSubTitle(filepath.Base(p.previewPath))
+}